@@ -0,0 +1,12 @@
+#!/bin/sh
+
+# ffmpeg and ffprobe refuse to run until the schema of this release is applied, migrating
+# an up to date database does nothing
+if ! ffmpegof db migrate; then
+    echo "ffmpegof db migrate failed, transcodes fail until it's run" >&2
+fi
+
+# the hosts listed in ffmpegof.yml are synced once on start instead of by every job
+ffmpegof sync
+
+exec /jellyfin/jellyfin "$@"
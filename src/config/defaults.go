@@ -3,8 +3,10 @@ package config
 func New() *Config {
 	return &Config{
 		Program: Program{
-			Log:   "/var/log/jellyfin",
-			Debug: false,
+			Log:              "/var/log/jellyfin",
+			Debug:            false,
+			StopTimeout:      10,
+			ProgressInterval: 5,
 		},
 		Directories: Directories{
 			Persist: "/run/shm",
@@ -14,6 +16,7 @@ func New() *Config {
 		Remote: Remote{
 			User:    "jellyfin",
 			Persist: 300,
+			Tty:     false,
 			Args: []string{
 				"-i",
 				"/var/lib/ffmpegof/.ssh/id_ed25519",
@@ -21,6 +24,9 @@ func New() *Config {
 		},
 		Commands: Commands{
 			Ssh:             "/usr/bin/ssh",
+			Docker:          "/usr/bin/docker",
+			Podman:          "/usr/bin/podman",
+			Kubectl:         "/usr/bin/kubectl",
 			Pre:             []string{},
 			Ffmpeg:          "/usr/lib/jellyfin-ffmpeg/ffmpeg",
 			Ffprobe:         "/usr/lib/jellyfin-ffmpeg/ffprobe",
@@ -38,13 +44,62 @@ func New() *Config {
 			},
 		},
 		Database: Database{
-			Type:     "sqlite",
-			Path:     "/var/lib/ffmpegof/db",
-			Host:     "localhost",
-			Port:     5432,
-			Name:     "ffmpegof",
-			Username: "postgres",
-			Password: "",
+			Type:        "sqlite",
+			Path:        "/var/lib/ffmpegof/db",
+			Host:        "localhost",
+			Port:        0,
+			Name:        "ffmpegof",
+			Username:    "",
+			Password:    "",
+			BusyTimeout: 5000,
+			Retries:     5,
+			Backoff:     50,
+			MaxBackoff:  2000,
+			OnFailure:   "run",
+		},
+		Worker: Worker{
+			Listen:       ":7878",
+			Port:         7878,
+			Cert:         "/etc/ffmpegof/worker.crt",
+			Key:          "/etc/ffmpegof/worker.key",
+			Ca:           "/etc/ffmpegof/ca.crt",
+			Insecure:     false,
+			Timeout:      1,
+			Transfer:     false,
+			Scratch:      "/tmp/ffmpegof",
+			SyncInterval: 500,
+		},
+		Watchdog: Watchdog{
+			Stall: 0,
+			Runtime: Runtime{
+				Probe:     0,
+				Info:      0,
+				Image:     0,
+				Hls:       0,
+				Transcode: 0,
+			},
+		},
+		History: History{
+			Retention: 30,
+		},
+		Hosts: []Host{},
+		Sync: Sync{
+			Mode:    "merge",
+			Startup: false,
+		},
+		Degraded: Degraded{
+			Enabled: true,
+			Cache:   "/var/lib/ffmpegof/hosts.json",
+			Journal: "/var/lib/ffmpegof/journal.jsonl",
+		},
+		Test: Test{
+			Media:      []string{},
+			Transcodes: "/var/lib/jellyfin/transcodes",
+			Device:     "/dev/dri/renderD128",
+			Encoders:   []string{},
+			Hwaccels:   []string{},
+			MaxLatency: 500,
+			MaxSkew:    2,
 		},
 	}
 }
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"os"
 	"path"
-	"path/filepath"
 	"strings"
 
 	"github.com/knadh/koanf/parsers/yaml"
@@ -53,27 +52,22 @@ func (c *Config) Load(dataDirPath string) error {
 	}
 
 	// Set database config
-	switch c.Database.Type {
-	case "sqlite":
-		{
-			err := os.MkdirAll(path.Dir(c.Database.Path), os.ModePerm)
-			if err != nil {
-				return fmt.Errorf("failed creating database directory: %w", err)
-			}
-			dbpath, err := filepath.Abs(c.Database.Path)
-			if err != nil {
-				return fmt.Errorf("failed loading sqlite file: %w", err)
-			}
-			c.Database.Path = dbpath + "?_foreign_keys=on"
-			c.Database.MigratorDir = "migrations/sqlite"
-		}
-	case "postgres":
-		{
-			c.Database.Path = fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable", c.Database.Host, c.Database.Port, c.Database.Username, c.Database.Password, c.Database.Name)
-			c.Database.MigratorDir = "migrations/postgres"
-		}
+	if err := c.Database.Resolve(); err != nil {
+		return err
+	}
+
+	// Check what happens to jobs that can't be recorded
+	switch c.Database.OnFailure {
+	case "run", "refuse":
+	default:
+		return fmt.Errorf("database on_failure must be run or refuse")
+	}
+
+	// Check host inventory config
+	switch c.Sync.Mode {
+	case "merge", "authoritative":
 	default:
-		return fmt.Errorf("database type isn't supported")
+		return fmt.Errorf("sync mode must be merge or authoritative")
 	}
 
 	// Set program PID
@@ -1,9 +1,15 @@
 package config
 
 type Program struct {
-	Pid   int    `koanf:"pid"`
-	Log   string `koanf:"log"`
-	Debug bool   `koanf:"debug"`
+	Version          string `koanf:"-"`
+	Pid              int    `koanf:"pid"`
+	BootId           string `koanf:"-"`
+	PidStart         int64  `koanf:"-"`
+	Instance         string `koanf:"instance"`
+	Log              string `koanf:"log"`
+	Debug            bool   `koanf:"debug"`
+	StopTimeout      int    `koanf:"stop_timeout"`
+	ProgressInterval int    `koanf:"progress_interval"`
 }
 
 type Directories struct {
@@ -15,11 +21,15 @@ type Directories struct {
 type Remote struct {
 	User    string   `koanf:"user"`
 	Persist int      `koanf:"persist"`
+	Tty     bool     `koanf:"tty"`
 	Args    []string `koanf:"args"`
 }
 
 type Commands struct {
 	Ssh             string   `koanf:"ssh"`
+	Docker          string   `koanf:"docker"`
+	Podman          string   `koanf:"podman"`
+	Kubectl         string   `koanf:"kubectl"`
 	Pre             []string `koanf:"pre"`
 	Ffmpeg          string   `koanf:"ffmpeg"`
 	Ffprobe         string   `koanf:"ffprobe"`
@@ -37,6 +47,73 @@ type Database struct {
 	Name        string `koanf:"name"`
 	Username    string `koanf:"username"`
 	Password    string `koanf:"password"`
+	BusyTimeout int    `koanf:"busy_timeout"`
+	Retries     int    `koanf:"retries"`
+	Backoff     int    `koanf:"backoff"`
+	MaxBackoff  int    `koanf:"max_backoff"`
+	OnFailure   string `koanf:"on_failure"`
+}
+
+type Worker struct {
+	Listen       string `koanf:"listen"`
+	Port         int    `koanf:"port"`
+	Cert         string `koanf:"cert"`
+	Key          string `koanf:"key"`
+	Ca           string `koanf:"ca"`
+	ServerName   string `koanf:"server_name"`
+	Insecure     bool   `koanf:"insecure"`
+	Timeout      int    `koanf:"timeout"`
+	Transfer     bool   `koanf:"transfer"`
+	Scratch      string `koanf:"scratch"`
+	SyncInterval int    `koanf:"sync_interval"`
+}
+
+type Runtime struct {
+	Probe     int `koanf:"probe"`
+	Info      int `koanf:"info"`
+	Image     int `koanf:"image"`
+	Hls       int `koanf:"hls"`
+	Transcode int `koanf:"transcode"`
+}
+
+type Watchdog struct {
+	Stall   int     `koanf:"stall"`
+	Runtime Runtime `koanf:"runtime"`
+}
+
+type History struct {
+	Retention int `koanf:"retention"`
+}
+
+// Host is an entry of the host inventory, which is synced into the database
+type Host struct {
+	Name      string `koanf:"name"`
+	Hostname  string `koanf:"hostname"`
+	Weight    int    `koanf:"weight"`
+	Transport string `koanf:"transport"`
+}
+
+type Sync struct {
+	Mode    string `koanf:"mode"`
+	Startup bool   `koanf:"startup"`
+}
+
+// Degraded is how ffmpeg and ffprobe run while the datastore is unavailable
+type Degraded struct {
+	Enabled bool   `koanf:"enabled"`
+	Cache   string `koanf:"cache"`
+	Journal string `koanf:"journal"`
+}
+
+// Test is what "ffmpegof test" expects of every host
+type Test struct {
+	Media      []string `koanf:"media"`
+	Transcodes string   `koanf:"transcodes"`
+	Device     string   `koanf:"device"`
+	Encoders   []string `koanf:"encoders"`
+	Hwaccels   []string `koanf:"hwaccels"`
+	MaxLatency int      `koanf:"max_latency"`
+	MaxSkew    int      `koanf:"max_skew"`
 }
 
 type Config struct {
@@ -45,4 +122,11 @@ type Config struct {
 	Remote      Remote      `koanf:"remote"`
 	Commands    Commands    `koanf:"commands"`
 	Database    Database    `koanf:"database"`
+	Worker      Worker      `koanf:"worker"`
+	Watchdog    Watchdog    `koanf:"watchdog"`
+	History     History     `koanf:"history"`
+	Hosts       []Host      `koanf:"hosts"`
+	Sync        Sync        `koanf:"sync"`
+	Degraded    Degraded    `koanf:"degraded"`
+	Test        Test        `koanf:"test"`
 }
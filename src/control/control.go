@@ -1,59 +1,232 @@
 package control
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/alecthomas/kong"
+	"github.com/mattn/go-isatty"
 	"github.com/rs/zerolog/log"
+	"github.com/tminaorg/ffmpegof/src/config"
+	"github.com/tminaorg/ffmpegof/src/degraded"
+	"github.com/tminaorg/ffmpegof/src/diagnose"
+	"github.com/tminaorg/ffmpegof/src/ffmpeg"
+	"github.com/tminaorg/ffmpegof/src/inventory"
+	"github.com/tminaorg/ffmpegof/src/migrate"
 	"github.com/tminaorg/ffmpegof/src/processor"
+	"github.com/tminaorg/ffmpegof/src/reaper"
+	"github.com/tminaorg/ffmpegof/src/rffmpeg"
+	"github.com/tminaorg/ffmpegof/src/worker"
+	"gopkg.in/yaml.v3"
 )
 
-func addHost(proc *processor.Processor, info Add) error {
+// checkFallback refuses names that would change the row standing in for localhost
+func checkFallback(proc *processor.Processor, name string) error {
+	fallback, err := proc.GetFallbackHost()
+	if err != nil {
+		return err
+	}
+	if fallback.Servername == name {
+		return fmt.Errorf("%s is reserved for the local fallback", name)
+	}
+	return nil
+}
+
+// checkManaged refuses changes to hosts of the inventory, every job syncs it into the database
+// before picking a host and would undo them
+func checkManaged(config *config.Config, name string) error {
+	if !config.Sync.Startup {
+		return nil
+	}
+	for _, host := range config.Hosts {
+		if host.Name == name || (host.Name == "" && host.Hostname == name) {
+			return fmt.Errorf("%s is listed under hosts in the config, which every job syncs, change it there or disable sync.startup", name)
+		}
+	}
+	return nil
+}
+
+// checkUnlisted refuses hosts the next job would remove again, as they're missing from the inventory
+func checkUnlisted(config *config.Config, name string) error {
+	if config.Sync.Startup && config.Sync.Mode == inventory.Authoritative && len(config.Hosts) > 0 {
+		return fmt.Errorf("sync.mode is authoritative, so every job removes %s again, list it under hosts in the config instead", name)
+	}
+	return nil
+}
+
+func addHost(config *config.Config, proc *processor.Processor, info Add) error {
+	// the number of jobs of a host is divided by its weight
+	if info.Weight < 1 {
+		return fmt.Errorf("weight must be at least 1")
+	}
 	if info.Name == "" {
 		info.Name = info.Host
 	}
+	if err := checkFallback(proc, info.Name); err != nil {
+		return err
+	}
+	if err := checkManaged(config, info.Name); err != nil {
+		return err
+	}
+	if err := checkUnlisted(config, info.Name); err != nil {
+		return err
+	}
 
 	return proc.AddHost(processor.Host{
 		Servername: info.Name,
 		Hostname:   info.Host,
 		Weight:     info.Weight,
 		Created:    time.Now(),
+		Transport:  info.Transport,
 	})
 }
 
-func removeHost(proc *processor.Processor, info Remove) error {
+// removeHost also removes the processes and states of the host through the foreign keys
+func removeHost(config *config.Config, proc *processor.Processor, info Remove) error {
+	if err := checkFallback(proc, info.Name); err != nil {
+		return err
+	}
+	if err := checkManaged(config, info.Name); err != nil {
+		return err
+	}
 	return proc.RemoveHost(processor.Host{
 		Servername: info.Name,
 	})
 }
 
-func printStatus(statusMappings []StatusMapping) {
+// editHost changes only the given fields of a host, unlike add it keeps its created time and
+// thus its place in the selection order
+func editHost(config *config.Config, proc *processor.Processor, info Edit) error {
+	if info.Weight == 0 && info.Hostname == "" && info.Rename == "" && info.Transport == "" {
+		return fmt.Errorf("nothing to change, use --weight, --hostname, --rename or --transport")
+	}
+	if info.Weight < 0 {
+		return fmt.Errorf("weight must be at least 1")
+	}
+	if err := checkFallback(proc, info.Name); err != nil {
+		return err
+	}
+	if err := checkManaged(config, info.Name); err != nil {
+		return err
+	}
+
+	hosts, err := proc.GetHostsByField("servername", info.Name)
+	if err != nil {
+		return err
+	}
+	if len(hosts) == 0 {
+		return fmt.Errorf("no host named %s", info.Name)
+	}
+	host := hosts[0]
+
+	if info.Rename != "" && info.Rename != host.Servername {
+		if err := checkFallback(proc, info.Rename); err != nil {
+			return err
+		}
+		if err := checkManaged(config, info.Rename); err != nil {
+			return err
+		}
+		if err := checkUnlisted(config, info.Rename); err != nil {
+			return err
+		}
+		taken, err := proc.GetHostsIdByField("servername", info.Rename)
+		if err != nil {
+			return err
+		}
+		if len(taken) > 0 {
+			return fmt.Errorf("a host named %s exists already", info.Rename)
+		}
+		host.Servername = info.Rename
+	}
+	if info.Weight > 0 {
+		host.Weight = info.Weight
+	}
+	if info.Hostname != "" {
+		host.Hostname = info.Hostname
+	}
+	if info.Transport != "" {
+		host.Transport = info.Transport
+	}
+	return proc.UpdateHost(host)
+}
+
+// formatCommand shows the progress of a command next to it once ffmpeg reported some, and the
+// instance running it when that isn't this one
+func formatCommand(job JobStatus, instance string) string {
+	pid := fmt.Sprintf("PID %d", job.Pid)
+	if job.Instance != "" && job.Instance != instance {
+		pid += " on " + job.Instance
+	}
+	if job.Started.IsZero() || job.Progress.OutTime == "" {
+		return fmt.Sprintf("%s: %s", pid, job.Command)
+	}
+
+	elapsed := time.Since(job.Started).Truncate(time.Second)
+	return fmt.Sprintf("%s [%.2fx at %s, elapsed %s, %d frames, %.1f fps, %s]: %s",
+		pid,
+		job.Progress.Speed,
+		job.Progress.OutTime,
+		elapsed,
+		job.Progress.Frame,
+		job.Progress.Fps,
+		job.Progress.Bitrate,
+		job.Command,
+	)
+}
+
+// escape returns the escape sequence only when stdout is a terminal, so piped tables stay plain
+func escape(sequence string) string {
+	if !isatty.IsTerminal(os.Stdout.Fd()) && !isatty.IsCygwinTerminal(os.Stdout.Fd()) {
+		return ""
+	}
+	return sequence
+}
+
+func printStatus(hostStatuses []HostStatus, instance string) {
 	servernameLen := 11
 	hostnameLen := 9
 	idLen := 3
 	weightLen := 7
+	transportLen := 10
 	stateLen := 6
-	for _, statusMapping := range statusMappings {
-		if len(statusMapping.Servername)+1 > servernameLen {
-			servernameLen = len(statusMapping.Servername) + 1
+	states := make([]string, len(hostStatuses))
+	for index, hostStatus := range hostStatuses {
+		// suspect and drained marks are shown next to the current state
+		states[index] = hostStatus.State
+		if hostStatus.Health.Suspect {
+			states[index] += " (suspect)"
 		}
-		if len(statusMapping.Hostname)+1 > hostnameLen {
-			hostnameLen = len(statusMapping.Hostname) + 1
+		if hostStatus.Drained {
+			states[index] += " (drained)"
 		}
-		if len(statusMapping.Id)+1 > idLen {
-			idLen = len(statusMapping.Id) + 1
+
+		if len(hostStatus.Name)+1 > servernameLen {
+			servernameLen = len(hostStatus.Name) + 1
 		}
-		if len(statusMapping.Weight)+1 > weightLen {
-			weightLen = len(statusMapping.Weight) + 1
+		if len(hostStatus.Hostname)+1 > hostnameLen {
+			hostnameLen = len(hostStatus.Hostname) + 1
 		}
-		if len(statusMapping.CurrentState)+1 > stateLen {
-			stateLen = len(statusMapping.CurrentState) + 1
+		if len(strconv.Itoa(hostStatus.Id))+1 > idLen {
+			idLen = len(strconv.Itoa(hostStatus.Id)) + 1
+		}
+		if len(strconv.Itoa(hostStatus.Weight))+1 > weightLen {
+			weightLen = len(strconv.Itoa(hostStatus.Weight)) + 1
+		}
+		if len(hostStatus.Transport)+1 > transportLen {
+			transportLen = len(hostStatus.Transport) + 1
+		}
+		if len(states[index])+1 > stateLen {
+			stateLen = len(states[index]) + 1
 		}
 	}
 
-	fmt.Printf("%-s%-*s %-*s %-*s %-*s %-*s %-s%-s\n",
-		"\033[1m",
+	fmt.Printf("%-s%-*s %-*s %-*s %-*s %-*s %-*s %-s%-s\n",
+		escape("\033[1m"),
 		servernameLen,
 		"Servername",
 		hostnameLen,
@@ -62,37 +235,41 @@ func printStatus(statusMappings []StatusMapping) {
 		"ID",
 		weightLen,
 		"Weight",
+		transportLen,
+		"Transport",
 		stateLen,
 		"State",
 		"Active Commands",
-		"\033[0m",
+		escape("\033[0m"),
 	)
 
-	for _, statusMapping := range statusMappings {
+	for index, hostStatus := range hostStatuses {
 		firstCommand := "N/A"
-		if len(statusMapping.Commands) > 0 {
-			firstCommand = fmt.Sprintf("PID %-d: %-s", statusMapping.Commands[0].ProcessId, statusMapping.Commands[0].Cmd)
+		if len(hostStatus.Jobs) > 0 {
+			firstCommand = formatCommand(hostStatus.Jobs[0], instance)
 		}
 
-		fmt.Printf("%-*s %-*s %-*s %-*s %-*s %-s\n",
+		fmt.Printf("%-*s %-*s %-*s %-*s %-*s %-*s %-s\n",
 			servernameLen,
-			statusMapping.Servername,
+			hostStatus.Name,
 			hostnameLen,
-			statusMapping.Hostname,
+			hostStatus.Hostname,
 			idLen,
-			statusMapping.Id,
+			strconv.Itoa(hostStatus.Id),
 			weightLen,
-			statusMapping.Weight,
+			strconv.Itoa(hostStatus.Weight),
+			transportLen,
+			hostStatus.Transport,
 			stateLen,
-			statusMapping.CurrentState,
+			states[index],
 			firstCommand,
 		)
 
 		if firstCommand != "N/A" {
-			for index, command := range statusMapping.Commands {
+			for index, job := range hostStatus.Jobs {
 				if index != 0 {
-					formattedCommand := fmt.Sprintf("PID %d: %s", command.ProcessId, command.Cmd)
-					fmt.Printf("%-*s %-*s %-*s %-*s %-*s %-s\n",
+					formattedCommand := formatCommand(job, instance)
+					fmt.Printf("%-*s %-*s %-*s %-*s %-*s %-*s %-s\n",
 						servernameLen,
 						"",
 						hostnameLen,
@@ -101,6 +278,8 @@ func printStatus(statusMappings []StatusMapping) {
 						"",
 						weightLen,
 						"",
+						transportLen,
+						"",
 						stateLen,
 						"",
 						formattedCommand,
@@ -111,89 +290,617 @@ func printStatus(statusMappings []StatusMapping) {
 	}
 }
 
-func status(proc *processor.Processor) error {
+// testHost runs the diagnostics on a host, the local fallback included
+func testHost(config *config.Config, proc *processor.Processor, info Test) (diagnose.Report, error) {
+	hosts, err := proc.GetHostsByField("servername", info.Name)
+	if err != nil {
+		return diagnose.Report{}, err
+	}
+	if len(hosts) == 0 {
+		fallback, err := proc.GetFallbackHost()
+		if err != nil {
+			return diagnose.Report{}, err
+		}
+		if fallback.Servername != info.Name {
+			return diagnose.Report{}, fmt.Errorf("no host named %s", info.Name)
+		}
+		hosts = append(hosts, fallback)
+	}
+
+	report := diagnose.Run(config, hosts[0])
+	printReport(report)
+	return report, nil
+}
+
+func printReport(report diagnose.Report) {
+	colors := map[string]string{
+		diagnose.Pass: "\033[32m",
+		diagnose.Warn: "\033[33m",
+		diagnose.Fail: "\033[31m",
+		diagnose.Skip: "\033[2m",
+	}
+
+	fmt.Printf("%sTesting %s (%s over %s)%s\n",
+		escape("\033[1m"),
+		report.Host.Servername,
+		report.Host.Hostname,
+		report.Host.Transport,
+		escape("\033[0m"),
+	)
+	for _, check := range report.Checks {
+		fmt.Printf("%s%-4s%s  %-13s %s\n",
+			escape(colors[check.Status]),
+			strings.ToUpper(check.Status),
+			escape("\033[0m"),
+			check.Name,
+			check.Detail,
+		)
+		if check.Hint != "" {
+			fmt.Printf("%-4s  %-13s hint: %s\n", "", "", check.Hint)
+		}
+	}
+	fmt.Printf("%d passed, %d warnings, %d failed, %d skipped\n",
+		report.Count(diagnose.Pass),
+		report.Count(diagnose.Warn),
+		report.Count(diagnose.Fail),
+		report.Count(diagnose.Skip),
+	)
+}
+
+// ofInstance keeps the processes of the instance, or all of them
+func ofInstance(processes []processor.Process, instance string, all bool) []processor.Process {
+	if all {
+		return processes
+	}
+	owned := make([]processor.Process, 0, len(processes))
+	for _, process := range processes {
+		if process.Instance == instance {
+			owned = append(owned, process)
+		}
+	}
+	return owned
+}
+
+// jobStatuses describes the processes as jobs, their class guessed from the command
+func jobStatuses(processes []processor.Process) []JobStatus {
+	jobs := make([]JobStatus, 0, len(processes))
+	for _, process := range processes {
+		jobs = append(jobs, JobStatus{
+			Pid:      process.ProcessId,
+			Instance: process.Instance,
+			Class:    ffmpeg.Class(process.Cmd),
+			Command:  process.Cmd,
+			Started:  process.Started,
+			Progress: Progress{
+				Frame:   process.Frame,
+				Fps:     process.Fps,
+				Speed:   process.Speed,
+				OutTime: process.OutTime,
+				Bitrate: process.Bitrate,
+				Updated: process.Updated,
+			},
+		})
+	}
+	return jobs
+}
+
+// hostStatuses collects the commands and states of this instance, unless all of them are
+// requested. Suspect and drained marks are shown whoever made them, as they affect every instance.
+func hostStatuses(proc *processor.Processor, instance string, info Status) ([]HostStatus, error) {
 	hosts, err := proc.GetHosts()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Determine if there are any fallback processes running
-	fallbackProcesses, err := proc.GetProcessesFromHost(processor.Host{
-		Id: 0,
-	})
+	fallback, err := proc.GetFallbackHost()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	fallbackProcesses, err := proc.GetProcessesFromHost(fallback)
+	if err != nil {
+		return nil, err
 	}
+	fallbackProcesses = ofInstance(fallbackProcesses, instance, info.All)
 
 	// Generate a mapping dictionary of hosts and processes
-	statusMappings := make([]StatusMapping, 0)
-
-	if len(fallbackProcesses) > 0 {
-		statusMappings = append(statusMappings, StatusMapping{
-			Id:           "0",
-			Servername:   "localhost (fallback)",
-			Hostname:     "localhost",
-			Weight:       "0",
-			CurrentState: "fallback",
-			Commands:     fallbackProcesses,
+	statuses := make([]HostStatus, 0)
+
+	if len(fallbackProcesses) > 0 && (info.Host == "" || info.Host == fallback.Servername) {
+		statuses = append(statuses, HostStatus{
+			Id:        fallback.Id,
+			Name:      fallback.Servername,
+			Hostname:  fallback.Hostname,
+			Weight:    fallback.Weight,
+			Transport: fallback.Transport,
+			Fallback:  true,
+			State:     "fallback",
+			Jobs:      jobStatuses(fallbackProcesses),
 		})
 	}
 
 	for _, host := range hosts {
+		if info.Host != "" && info.Host != host.Servername {
+			continue
+		}
+
 		// Get the latest state
 		states, err := proc.GetStatesFromHost(host)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		currentState := ""
-		if len(states) == 0 {
-			currentState = "idle"
-		} else {
-			currentState = states[0].State
+		// suspect and drained states outlive the processes, so they are kept apart from the current state
+		hostStatus := HostStatus{
+			Id:        host.Id,
+			Name:      host.Servername,
+			Hostname:  host.Hostname,
+			Weight:    host.Weight,
+			Transport: host.Transport,
+		}
+		for _, state := range states {
+			if state.State == "suspect" {
+				hostStatus.Health.Suspect = true
+			} else if state.State == "drained" {
+				hostStatus.Drained = true
+			} else if hostStatus.State == "" && (info.All || state.Instance == instance) {
+				hostStatus.State = state.State
+				hostStatus.MarkingPid = state.ProcessId
+				hostStatus.MarkingInstance = state.Instance
+			}
 		}
+		if hostStatus.State == "" {
+			hostStatus.State = "idle"
+		}
+		hostStatus.Health.Bad = hostStatus.State == "bad"
 
 		// Get processes from host
 		processes, err := proc.GetProcessesFromHost(host)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		hostStatus.Jobs = jobStatuses(ofInstance(processes, instance, info.All))
 
-		// Create the mappings entry
-		statusMappings = append(statusMappings, StatusMapping{
-			Id:           fmt.Sprintf("%d", host.Id),
-			Servername:   host.Servername,
-			Hostname:     host.Hostname,
-			Weight:       fmt.Sprintf("%d", host.Weight),
-			CurrentState: currentState,
-			Commands:     processes,
-		})
+		statuses = append(statuses, hostStatus)
 	}
 
-	log.Info().Msg("Outputting status of hosts")
-	printStatus(statusMappings)
+	if info.Host != "" && len(statuses) == 0 && info.Host != fallback.Servername {
+		return nil, fmt.Errorf("no host named %s", info.Host)
+	}
+	return statuses, nil
+}
 
-	return err
+// status shows the hosts as a table for people or as JSON or YAML for scripts
+func status(proc *processor.Processor, instance string, info Status) error {
+	statuses, err := hostStatuses(proc, instance, info)
+	if err != nil {
+		return err
+	}
+
+	switch info.Output {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(StatusReport{Instance: instance, Hosts: statuses})
+	case "yaml":
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(StatusReport{Instance: instance, Hosts: statuses}); err != nil {
+			return err
+		}
+		return encoder.Close()
+	default:
+		log.Info().Msg("Outputting status of hosts")
+		printStatus(statuses, instance)
+		return nil
+	}
 }
 
-func clear(proc *processor.Processor, info Clear) (error, error) {
+// clear removes the processes and states of this instance, unless all of them are requested
+func clear(proc *processor.Processor, instance string, info Clear) (error, error) {
 	if info.Name != "" {
 		hosts, err := proc.GetHostsIdByField("servername", info.Name)
+		if err == nil && len(hosts) == 0 {
+			err = fmt.Errorf("no host named %s", info.Name)
+		}
 		if err != nil {
 			return err, err
-		} else {
+		} else if info.All {
 			return proc.RemoveProcessesByField("host_id", processor.Process{
 					HostId: hosts[0].Id,
 				}), proc.RemoveStatesByField("host_id", processor.State{
 					HostId: hosts[0].Id,
 				})
+		} else {
+			return clearHost(proc, instance, hosts[0])
 		}
-	} else {
+	} else if info.All {
 		return proc.RemoveProcesses(), proc.RemoveStates()
+	} else {
+		return proc.RemoveProcessesByField("instance", processor.Process{
+				Instance: instance,
+			}), proc.RemoveStatesByField("instance", processor.State{
+				Instance: instance,
+			})
+	}
+}
+
+// clearHost removes the processes and states the instance has on a host
+func clearHost(proc *processor.Processor, instance string, host processor.Host) (error, error) {
+	processes, err := proc.GetProcessesFromHost(host)
+	if err != nil {
+		return err, nil
+	}
+	for _, process := range processes {
+		if process.Instance != instance {
+			continue
+		}
+		if err := proc.RemoveProcessesByField("id", processor.Process{Id: process.Id}); err != nil {
+			return err, nil
+		}
+	}
+
+	states, err := proc.GetStatesFromHost(host)
+	if err != nil {
+		return nil, err
+	}
+	for _, state := range states {
+		if state.Instance != instance {
+			continue
+		}
+		if err := proc.RemoveStatesByField("id", processor.State{Id: state.Id}); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func prune(proc *processor.Processor, instance string) error {
+	report, err := reaper.Prune(proc, instance)
+	for _, process := range report.Processes {
+		fmt.Printf("removed process of PID %d on host %d: %s\n", process.ProcessId, process.HostId, process.Cmd)
+	}
+	for _, state := range report.States {
+		fmt.Printf("removed %s state of PID %d on host %d\n", state.State, state.ProcessId, state.HostId)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Info().
+		Int("processes", len(report.Processes)).
+		Int("states", len(report.States)).
+		Msg("pruned stale processes and states")
+	return nil
+}
+
+// parseTime accepts a date, an RFC 3339 time or a duration ago
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+func printHistory(jobs []processor.Job) {
+	servernameLen := 11
+	for _, job := range jobs {
+		if len(job.Servername)+1 > servernameLen {
+			servernameLen = len(job.Servername) + 1
+		}
+	}
+
+	fmt.Printf("%-s%-19s %-*s %-9s %-7s %-4s %-9s %-8s %-7s %-s%-s\n",
+		escape("\033[1m"),
+		"Started",
+		servernameLen,
+		"Servername",
+		"Class",
+		"Status",
+		"Exit",
+		"Duration",
+		"Overhead",
+		"Retries",
+		"Command",
+		escape("\033[0m"),
+	)
+
+	for _, job := range jobs {
+		fmt.Printf("%-19s %-*s %-9s %-7s %-4d %-9s %-8s %-7d %-s\n",
+			job.Started.Local().Format("2006-01-02 15:04:05"),
+			servernameLen,
+			job.Servername,
+			job.Class,
+			job.Status,
+			job.ExitCode,
+			job.Ended.Sub(job.Started).Truncate(time.Second),
+			job.Overhead.Truncate(time.Millisecond),
+			job.Retries,
+			job.Cmd,
+		)
+		if job.Reason != "" && job.Status != "success" {
+			fmt.Printf("%-19s %-*s %-s\n", "", servernameLen, "", job.Reason)
+		}
+	}
+}
+
+func history(proc *processor.Processor, info History) error {
+	since, err := parseTime(info.Since)
+	if err != nil {
+		return fmt.Errorf("since: %w", err)
+	}
+	until, err := parseTime(info.Until)
+	if err != nil {
+		return fmt.Errorf("until: %w", err)
+	}
+
+	jobs, err := proc.GetJobs(processor.JobFilter{
+		Servername: info.Host,
+		Since:      since,
+		Until:      until,
+		Status:     info.Status,
+		Class:      info.Class,
+		Limit:      info.Limit,
+	})
+	if err != nil {
+		return err
+	}
+
+	printHistory(jobs)
+	return nil
+}
+
+func workerInfo(config *config.Config, info WorkerInfo) error {
+	workerInfo, err := worker.NewClient(config, info.Address).Info()
+	if err != nil {
+		return err
+	}
+
+	out, err := json.MarshalIndent(workerInfo, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+
+	return nil
+}
+
+func printPlan(plan inventory.Plan, dryRun bool) {
+	for _, host := range plan.Add {
+		fmt.Printf("+ %s (%s, weight %d, %s)\n", host.Servername, host.Hostname, host.Weight, host.Transport)
+	}
+	for _, update := range plan.Update {
+		fmt.Printf("~ %s (%s, weight %d, %s -> %s, weight %d, %s)\n",
+			update.To.Servername,
+			update.From.Hostname, update.From.Weight, update.From.Transport,
+			update.To.Hostname, update.To.Weight, update.To.Transport,
+		)
+	}
+	for _, host := range plan.Remove {
+		fmt.Printf("- %s (%s)\n", host.Servername, host.Hostname)
+	}
+
+	if plan.Empty() {
+		fmt.Println("hosts are in sync")
+	} else if dryRun {
+		fmt.Printf("would add %d, update %d and remove %d hosts\n", len(plan.Add), len(plan.Update), len(plan.Remove))
+	}
+}
+
+func syncHosts(config *config.Config, proc *processor.Processor, info Sync) error {
+	mode := config.Sync.Mode
+	if info.Mode != "" {
+		mode = info.Mode
 	}
+
+	plan, err := inventory.Sync(config, proc, mode, info.DryRun)
+	if err != nil {
+		return err
+	}
+	printPlan(plan, info.DryRun)
+	return nil
+}
+
+func exportHosts(proc *processor.Processor, info HostsExport) error {
+	if info.Output == "" {
+		return inventory.Export(proc, os.Stdout, info.Format)
+	}
+
+	file, err := os.Create(info.Output)
+	if err != nil {
+		return err
+	}
+	if err := inventory.Export(proc, file, info.Format); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func importHosts(proc *processor.Processor, info HostsImport) error {
+	in := os.Stdin
+	if info.File != "-" {
+		file, err := os.Open(info.File)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+
+	entries, err := inventory.Read(in)
+	if err != nil {
+		return err
+	}
+	mode := inventory.Merge
+	if info.Replace {
+		mode = inventory.Authoritative
+	}
+
+	plan, err := inventory.Reconcile(proc, entries, mode, info.DryRun)
+	if err != nil {
+		return err
+	}
+	printPlan(plan, info.DryRun)
+	return nil
 }
 
-func Run(proc *processor.Processor) {
+// importRffmpeg writes the ffmpegof config equivalent to the one of rffmpeg and imports its hosts
+func importRffmpeg(proc *processor.Processor, info ImportRffmpeg) error {
+	translation, err := rffmpeg.ReadConfig(info.Config)
+	if err != nil {
+		return err
+	}
+	if info.Database != "" {
+		translation.Database, err = rffmpeg.ParseDatabase(info.Database)
+		if err != nil {
+			return err
+		}
+	}
+	entries, err := rffmpeg.ReadHosts(translation.Database)
+	if err != nil {
+		return fmt.Errorf("rffmpeg hosts: %w", err)
+	}
+
+	settings, err := translation.YAML()
+	if err != nil {
+		return err
+	}
+	settings = append([]byte(fmt.Sprintf("# Translated from %s by \"ffmpegof import-rffmpeg\"\n", info.Config)), settings...)
+	switch {
+	case info.DryRun || info.Output == "-":
+		fmt.Print(string(settings))
+	default:
+		if _, err := os.Stat(info.Output); err == nil && !info.Force {
+			return fmt.Errorf("%s already exists, use --force to overwrite it", info.Output)
+		}
+		if err := os.MkdirAll(filepath.Dir(info.Output), os.ModePerm); err != nil {
+			return err
+		}
+		if err := os.WriteFile(info.Output, settings, 0644); err != nil {
+			return err
+		}
+		log.Info().Str("config", info.Output).Msg("wrote ffmpegof config")
+	}
+
+	plan, err := inventory.Reconcile(proc, entries, inventory.Merge, info.DryRun)
+	if err != nil {
+		return err
+	}
+	printPlan(plan, info.DryRun)
+
+	for _, untranslated := range translation.Untranslated {
+		log.Warn().
+			Str("setting", untranslated.Setting).
+			Msg("not translated: " + untranslated.Reason)
+	}
+	return nil
+}
+
+func printMigrations(statuses []migrate.Status) {
+	fmt.Printf("%-s%-8s %-20s %-8s %-s%-s\n",
+		escape("\033[1m"),
+		"Version",
+		"Name",
+		"Applied",
+		"Reversible",
+		escape("\033[0m"),
+	)
+
+	pending, newer := 0, 0
+	for _, status := range statuses {
+		name := status.Name
+		if status.Unknown {
+			name = "(newer release)"
+			newer++
+		}
+		if !status.Applied {
+			pending++
+		}
+		fmt.Printf("%-8d %-20s %-8t %-t\n",
+			status.Version,
+			name,
+			status.Applied,
+			status.Reversible,
+		)
+	}
+
+	if newer > 0 {
+		fmt.Printf("%d migrations applied by a newer release\n", newer)
+	} else if pending > 0 {
+		fmt.Printf("%d pending migrations\n", pending)
+	} else {
+		fmt.Println("schema is up to date")
+	}
+}
+
+func db(config *config.Config, mg *migrate.Migrator, command string, info Db) error {
+	switch command {
+	case "db migrate":
+		return processor.Migrate(config.Database.Type, mg)
+	case "db rollback <version>":
+		if info.Rollback.Version < 0 {
+			return fmt.Errorf("version can't be negative")
+		}
+		return processor.Rollback(config.Database.Type, mg, info.Rollback.Version)
+	default:
+		statuses, err := processor.MigrationStatus(config.Database.Type, mg)
+		if err != nil {
+			return err
+		}
+		printMigrations(statuses)
+		return nil
+	}
+}
+
+// copyDatabase migrates the destination to the current schema and copies the source into it,
+// settings the URLs leave out are those of the configured database
+func copyDatabase(configured config.Database, setup func(database config.Database) (*processor.Processor, error), setupMigrator func(database config.Database) (*migrate.Migrator, error), info DbCopy) (processor.Copied, error) {
+	var err error
+	from := configured
+	if info.From != "" {
+		from, err = config.ParseDatabase(info.From, configured)
+		if err != nil {
+			return processor.Copied{}, fmt.Errorf("from: %w", err)
+		}
+	}
+	to, err := config.ParseDatabase(info.To, configured)
+	if err != nil {
+		return processor.Copied{}, fmt.Errorf("to: %w", err)
+	}
+	if from.Type == "memory" {
+		return processor.Copied{}, fmt.Errorf("the memory database can't be copied")
+	}
+	if from.Type == to.Type && from.Path == to.Path {
+		return processor.Copied{}, fmt.Errorf("source and destination are the same database")
+	}
+
+	mg, err := setupMigrator(to)
+	if err != nil {
+		return processor.Copied{}, fmt.Errorf("to: %w", err)
+	}
+	if err := processor.Migrate(to.Type, mg); err != nil {
+		return processor.Copied{}, fmt.Errorf("to: %w", err)
+	}
+
+	source, err := setup(from)
+	if err != nil {
+		return processor.Copied{}, fmt.Errorf("from: %w", err)
+	}
+	destination, err := setup(to)
+	if err != nil {
+		return processor.Copied{}, fmt.Errorf("to: %w", err)
+	}
+	return processor.Copy(source, destination, info.Force)
+}
+
+func Run(config *config.Config, setup func(database config.Database) (*processor.Processor, error), setupMigrator func(database config.Database) (*migrate.Migrator, error)) {
 	// parse cli
 	cli := Cli{}
 
@@ -211,11 +918,79 @@ func Run(proc *processor.Processor) {
 		log.Fatal().Err(err).Msg("failed parsing cli")
 	}
 
+	// functions that don't need the datastore
+	switch ctx.Command() {
+	case "worker serve":
+		{
+			if cli.Worker.Serve.Listen != "" {
+				config.Worker.Listen = cli.Worker.Serve.Listen
+			}
+			err := worker.Serve(config, config.Program.Version)
+			if err != nil {
+				log.Fatal().
+					Err(err).
+					Msg("failed running worker")
+			}
+			return
+		}
+	case "worker info <address>":
+		{
+			err := workerInfo(config, cli.Worker.Info)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("failed reading worker info")
+			}
+			return
+		}
+	}
+
+	// functions that only need the migrator, as the datastore refuses an outdated schema
+	switch ctx.Command() {
+	case "db migrate", "db status", "db rollback <version>":
+		{
+			mg, err := setupMigrator(config.Database)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed setting up migrator")
+			}
+			err = db(config, mg, ctx.Command(), cli.Db)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("failed managing database schema")
+			} else if ctx.Command() != "db status" {
+				log.Info().
+					Msg("succesfully updated database schema")
+			}
+			return
+		}
+	case "db copy":
+		{
+			copied, err := copyDatabase(config.Database, setup, setupMigrator, cli.Db.Copy)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("failed copying database")
+			} else {
+				log.Info().
+					Int("hosts", copied.Hosts).
+					Int("jobs", copied.Jobs).
+					Msg("succesfully copied database")
+			}
+			return
+		}
+	}
+
+	proc, err := setup(config.Database)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed setting up datastore")
+	}
+
 	// functions based on arguments
 	switch ctx.Command() {
 	case "add <host>":
 		{
-			err := addHost(proc, cli.Add)
+			err := addHost(config, proc, cli.Add)
 			if err != nil {
 				log.Error().
 					Err(err).
@@ -223,11 +998,12 @@ func Run(proc *processor.Processor) {
 			} else {
 				log.Info().
 					Msg("succesfully added host")
+				degraded.Refresh(config, proc)
 			}
 		}
 	case "remove <name>":
 		{
-			err := removeHost(proc, cli.Remove)
+			err := removeHost(config, proc, cli.Remove)
 			if err != nil {
 				log.Error().
 					Err(err).
@@ -235,20 +1011,71 @@ func Run(proc *processor.Processor) {
 			} else {
 				log.Info().
 					Msg("succesfully removed host")
+				degraded.Refresh(config, proc)
+			}
+		}
+	case "edit <name>":
+		{
+			err := editHost(config, proc, cli.Edit)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("failed editing host")
+			} else {
+				log.Info().
+					Msg("succesfully edited host")
+				degraded.Refresh(config, proc)
+			}
+		}
+	case "test <name>":
+		{
+			report, err := testHost(config, proc, cli.Test)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("failed testing host")
+			} else if failed := report.Count(diagnose.Fail); failed > 0 {
+				log.Error().
+					Int("failed", failed).
+					Msg("host failed its tests")
+			} else {
+				log.Info().
+					Msg("succesfully tested host")
 			}
 		}
 	case "status":
 		{
-			err := status(proc)
+			// stale rows would show up as running commands
+			if _, err := reaper.Prune(proc, config.Program.Instance); err != nil {
+				log.Warn().
+					Err(err).
+					Msg("failed pruning stale processes and states")
+			}
+			err := status(proc, config.Program.Instance, cli.Status)
 			if err != nil {
 				log.Error().
 					Err(err).
 					Msg("failed reading status")
 			}
 		}
+	case "top":
+		{
+			// stale rows would show up as running commands
+			if _, err := reaper.Prune(proc, config.Program.Instance); err != nil {
+				log.Warn().
+					Err(err).
+					Msg("failed pruning stale processes and states")
+			}
+			err := top(proc, config.Program.Instance, cli.Top)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("failed showing status")
+			}
+		}
 	case "clear":
 		{
-			errProcess, errState := clear(proc, cli.Clear)
+			errProcess, errState := clear(proc, config.Program.Instance, cli.Clear)
 			if errProcess != nil {
 				log.Error().
 					Err(errProcess).
@@ -262,6 +1089,72 @@ func Run(proc *processor.Processor) {
 					Msg("succesfully cleared processes and states")
 			}
 		}
+	case "history":
+		{
+			err := history(proc, cli.History)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("failed reading history")
+			}
+		}
+	case "sync":
+		{
+			err := syncHosts(config, proc, cli.Sync)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("failed syncing hosts")
+			} else if !cli.Sync.DryRun {
+				log.Info().
+					Msg("succesfully synced hosts")
+				degraded.Refresh(config, proc)
+			}
+		}
+	case "hosts export":
+		{
+			err := exportHosts(proc, cli.Hosts.Export)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("failed exporting hosts")
+			}
+		}
+	case "import-rffmpeg":
+		{
+			err := importRffmpeg(proc, cli.ImportRffmpeg)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("failed importing rffmpeg")
+			} else if !cli.ImportRffmpeg.DryRun {
+				log.Info().
+					Msg("succesfully imported rffmpeg")
+				degraded.Refresh(config, proc)
+			}
+		}
+	case "hosts import <file>":
+		{
+			err := importHosts(proc, cli.Hosts.Import)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("failed importing hosts")
+			} else if !cli.Hosts.Import.DryRun {
+				log.Info().
+					Msg("succesfully imported hosts")
+				degraded.Refresh(config, proc)
+			}
+		}
+	case "prune":
+		{
+			err := prune(proc, config.Program.Instance)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("failed pruning processes and states")
+			}
+		}
 	default:
 		{
 			log.Fatal().
@@ -0,0 +1,256 @@
+package control
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/rs/zerolog/log"
+	"github.com/tminaorg/ffmpegof/src/config"
+	"github.com/tminaorg/ffmpegof/src/degraded"
+	"github.com/tminaorg/ffmpegof/src/migrate"
+	"github.com/tminaorg/ffmpegof/src/processor"
+	"github.com/tminaorg/ffmpegof/src/reaper"
+)
+
+// rffmpegHosts finds the hosts rffmpeg would, by ID, name or hostname
+func rffmpegHosts(proc *processor.Processor, value string) ([]processor.Host, error) {
+	hosts, err := proc.GetHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]processor.Host, 0)
+	for _, host := range hosts {
+		if strconv.Itoa(host.Id) == value || host.Servername == value || host.Hostname == value {
+			found = append(found, host)
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("no host with ID, name or hostname %s", value)
+	}
+	return found, nil
+}
+
+func rffmpegRemove(config *config.Config, proc *processor.Processor, info RffmpegRemove) error {
+	hosts, err := rffmpegHosts(proc, info.Host)
+	if err != nil {
+		return err
+	}
+	for _, host := range hosts {
+		if err := removeHost(config, proc, Remove{Name: host.Servername}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rffmpegClear clears the processes and states of every instance, as rffmpeg knows of no others
+func rffmpegClear(proc *processor.Processor, instance string, info RffmpegClear) (error, error) {
+	if info.Host == "" {
+		return clear(proc, instance, Clear{All: true})
+	}
+
+	hosts, err := rffmpegHosts(proc, info.Host)
+	if err != nil {
+		return err, err
+	}
+	for _, host := range hosts {
+		if errProcess, errState := clear(proc, instance, Clear{Name: host.Servername, All: true}); errProcess != nil || errState != nil {
+			return errProcess, errState
+		}
+	}
+	return nil, nil
+}
+
+// latestLog is the newest log file written by the logger
+func latestLog(dir string) (string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "ffmpegof_*.log"))
+	if err != nil {
+		return "", err
+	}
+	if len(paths) == 0 {
+		return "", fmt.Errorf("no log files in %s", dir)
+	}
+	// named after the date, so the newest sorts last
+	sort.Strings(paths)
+	return paths[len(paths)-1], nil
+}
+
+// showLog prints the newest log file and, when following, what is written to it afterwards
+func showLog(dir string, follow bool) error {
+	path, err := latestLog(dir)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { file.Close() }()
+
+	offset, err := io.Copy(os.Stdout, file)
+	if err != nil || !follow {
+		return err
+	}
+
+	for {
+		time.Sleep(500 * time.Millisecond)
+
+		// the logger moves on to a new file every day and rotates the current one when it's full
+		latest, err := latestLog(dir)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(latest)
+		if err != nil {
+			return err
+		}
+		if latest != path || info.Size() < offset {
+			file.Close()
+			if file, err = os.Open(latest); err != nil {
+				return err
+			}
+			path, offset = latest, 0
+		}
+
+		written, err := io.Copy(os.Stdout, file)
+		if err != nil {
+			return err
+		}
+		offset += written
+	}
+}
+
+// RunRffmpeg accepts the command set and flags of rffmpeg, mapped onto the ones of ffmpegof
+func RunRffmpeg(config *config.Config, setup func(database config.Database) (*processor.Processor, error), setupMigrator func(database config.Database) (*migrate.Migrator, error)) {
+	// parse cli
+	cli := RffmpegCli{}
+
+	ctx := kong.Parse(&cli,
+		kong.Name("rffmpeg"),
+		kong.Description("FFmpeg over Fabrics, with the commands of rffmpeg"),
+		kong.UsageOnError(),
+		kong.ConfigureHelp(kong.HelpOptions{
+			Summary: true,
+			Compact: true,
+		}),
+	)
+
+	if err := ctx.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("failed parsing cli")
+	}
+
+	// functions that don't need the datastore
+	switch ctx.Command() {
+	case "log":
+		{
+			err := showLog(config.Program.Log, cli.Log.Follow)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("failed showing log")
+			}
+			return
+		}
+	case "init":
+		{
+			// rffmpeg erases the database, migrating keeps the hosts and is safe to repeat
+			mg, err := setupMigrator(config.Database)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed setting up migrator")
+			}
+			err = processor.Migrate(config.Database.Type, mg)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("failed initializing database")
+			} else {
+				log.Info().
+					Msg("succesfully initialized database")
+			}
+			return
+		}
+	}
+
+	proc, err := setup(config.Database)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed setting up datastore")
+	}
+
+	switch ctx.Command() {
+	case "status":
+		{
+			// stale rows would show up as running commands
+			if _, err := reaper.Prune(proc, config.Program.Instance); err != nil {
+				log.Warn().
+					Err(err).
+					Msg("failed pruning stale processes and states")
+			}
+			err := status(proc, config.Program.Instance, Status{All: true})
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("failed reading status")
+			}
+		}
+	case "add <host>":
+		{
+			err := addHost(config, proc, Add{
+				Name:      cli.Add.Name,
+				Weight:    cli.Add.Weight,
+				Transport: "ssh",
+				Host:      cli.Add.Host,
+			})
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("failed adding host")
+			} else {
+				log.Info().
+					Msg("succesfully added host")
+				degraded.Refresh(config, proc)
+			}
+		}
+	case "remove <host>":
+		{
+			err := rffmpegRemove(config, proc, cli.Remove)
+			if err != nil {
+				log.Error().
+					Err(err).
+					Msg("failed removing host")
+			} else {
+				log.Info().
+					Msg("succesfully removed host")
+				degraded.Refresh(config, proc)
+			}
+		}
+	case "clear", "clear <host>":
+		{
+			errProcess, errState := rffmpegClear(proc, config.Program.Instance, cli.Clear)
+			if errProcess != nil {
+				log.Error().
+					Err(errProcess).
+					Msg("failed clearing processes")
+			} else if errState != nil {
+				log.Error().
+					Err(errState).
+					Msg("failed clearing states")
+			} else {
+				log.Info().
+					Msg("succesfully cleared processes and states")
+			}
+		}
+	default:
+		{
+			log.Fatal().
+				Err(fmt.Errorf("%s", ctx.Command())).
+				Msg("invalid command")
+		}
+	}
+}
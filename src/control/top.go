@@ -0,0 +1,463 @@
+package control
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/tminaorg/ffmpegof/src/processor"
+	"github.com/tminaorg/ffmpegof/src/reaper"
+	"golang.org/x/term"
+)
+
+const (
+	barWidth         = 20
+	maxTransitions   = 50
+	shownTransitions = 5
+)
+
+// topRow is a line of the view that can be selected, a host or one of its jobs
+type topRow struct {
+	host int
+	// job is the index of the job on the host, -1 for the host itself
+	job int
+}
+
+// transition is a change of the state of a host seen between two refreshes
+type transition struct {
+	at   time.Time
+	host string
+	from string
+	to   string
+}
+
+type topView struct {
+	proc     *processor.Processor
+	instance string
+	info     Top
+
+	hosts     []HostStatus
+	refreshed time.Time
+	// labels are the states of the hosts at the last refresh, to spot transitions
+	labels      map[string]string
+	transitions []transition
+
+	selected int
+	offset   int
+	// confirm is the PID waiting for a second x before it is stopped
+	confirm int
+	message string
+}
+
+// hostLabel is the state of a host with its suspect and drained marks
+func hostLabel(host HostStatus) string {
+	label := host.State
+	if host.Health.Suspect {
+		label += " (suspect)"
+	}
+	if host.Drained {
+		label += " (drained)"
+	}
+	return label
+}
+
+// bar shows the jobs of a host against its capacity, which is its weight
+func bar(jobs int, capacity int) string {
+	filled := jobs * barWidth / capacity
+	if filled > barWidth {
+		filled = barWidth
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", barWidth-filled) + "]"
+}
+
+// toggleDrain drains a host so it gets no new jobs, or undrains it whichever instance drained it
+func toggleDrain(proc *processor.Processor, instance string, host HostStatus) (bool, error) {
+	states, err := proc.GetStatesFromHost(processor.Host{Id: host.Id})
+	if err != nil {
+		return false, err
+	}
+
+	undrained := false
+	for _, state := range states {
+		if state.State != "drained" {
+			continue
+		}
+		if err := proc.RemoveStatesByField("id", processor.State{Id: state.Id}); err != nil {
+			return false, err
+		}
+		undrained = true
+	}
+	if undrained {
+		return false, nil
+	}
+
+	// like suspect states, it isn't tied to a running ffmpegof
+	return true, proc.AddState(processor.State{
+		HostId:    host.Id,
+		ProcessId: 0,
+		State:     "drained",
+		Instance:  instance,
+	})
+}
+
+// stopJob sends SIGTERM to the ffmpegof running a job, which stops ffmpeg gracefully. PIDs of
+// other instances live in another PID namespace, so only jobs of this instance can be stopped.
+func stopJob(proc *processor.Processor, instance string, job JobStatus) error {
+	if job.Instance != "" && job.Instance != instance {
+		return fmt.Errorf("PID %d runs on %s, it can only be stopped from there", job.Pid, job.Instance)
+	}
+
+	processes, err := proc.GetProcesses()
+	if err != nil {
+		return err
+	}
+	for _, process := range processes {
+		if process.ProcessId != job.Pid || process.Instance != job.Instance {
+			continue
+		}
+		// the PID may belong to another process by now
+		if !reaper.Alive(process.ProcessId, process.BootId, process.PidStart) {
+			return fmt.Errorf("PID %d is gone", job.Pid)
+		}
+		wrapper, err := os.FindProcess(process.ProcessId)
+		if err != nil {
+			return err
+		}
+		return wrapper.Signal(syscall.SIGTERM)
+	}
+	return fmt.Errorf("PID %d finished already", job.Pid)
+}
+
+func (view *topView) refresh() {
+	hosts, err := hostStatuses(view.proc, view.instance, Status{All: view.info.All})
+	if err != nil {
+		view.message = "failed reading status: " + err.Error()
+		return
+	}
+
+	now := time.Now()
+	labels := make(map[string]string, len(hosts))
+	for _, host := range hosts {
+		label := hostLabel(host)
+		labels[host.Name] = label
+		if previous, found := view.labels[host.Name]; found && previous != label {
+			view.transitions = append(view.transitions, transition{at: now, host: host.Name, from: previous, to: label})
+		}
+	}
+	if len(view.transitions) > maxTransitions {
+		view.transitions = view.transitions[len(view.transitions)-maxTransitions:]
+	}
+
+	view.hosts = hosts
+	view.labels = labels
+	view.refreshed = now
+	if rows := view.rows(); view.selected >= len(rows) {
+		view.selected = len(rows) - 1
+	}
+	if view.selected < 0 {
+		view.selected = 0
+	}
+}
+
+func (view *topView) rows() []topRow {
+	rows := make([]topRow, 0, len(view.hosts))
+	for hostIndex, host := range view.hosts {
+		rows = append(rows, topRow{host: hostIndex, job: -1})
+		for jobIndex := range host.Jobs {
+			rows = append(rows, topRow{host: hostIndex, job: jobIndex})
+		}
+	}
+	return rows
+}
+
+func (view *topView) current() (topRow, bool) {
+	rows := view.rows()
+	if view.selected < 0 || view.selected >= len(rows) {
+		return topRow{}, false
+	}
+	return rows[view.selected], true
+}
+
+func (view *topView) drain() {
+	row, found := view.current()
+	if !found {
+		return
+	}
+	host := view.hosts[row.host]
+	if host.Fallback {
+		view.message = "the local fallback can't be drained"
+		return
+	}
+
+	drained, err := toggleDrain(view.proc, view.instance, host)
+	switch {
+	case err != nil:
+		view.message = fmt.Sprintf("failed draining %s: %s", host.Name, err)
+	case drained:
+		view.message = fmt.Sprintf("drained %s, it finishes its jobs but gets no new ones", host.Name)
+	default:
+		view.message = fmt.Sprintf("undrained %s", host.Name)
+	}
+	view.refresh()
+}
+
+func (view *topView) stop() {
+	row, found := view.current()
+	if !found || row.job < 0 {
+		view.message = "select a job to stop"
+		return
+	}
+	job := view.hosts[row.host].Jobs[row.job]
+
+	// stopping a job fails it for the media server, so it is confirmed first
+	if view.confirm != job.Pid {
+		view.confirm = job.Pid
+		view.message = fmt.Sprintf("press x again to stop PID %d", job.Pid)
+		return
+	}
+	view.confirm = 0
+
+	if err := stopJob(view.proc, view.instance, job); err != nil {
+		view.message = fmt.Sprintf("failed stopping PID %d: %s", job.Pid, err)
+	} else {
+		view.message = fmt.Sprintf("stopping PID %d", job.Pid)
+	}
+	view.refresh()
+}
+
+// handle reacts to a key and reports whether the view should be closed
+func (view *topView) handle(key string) bool {
+	if key != "x" {
+		view.confirm = 0
+	}
+
+	switch key {
+	case "q", "\x03":
+		return true
+	case "j", "\033[B", "\033OB":
+		if view.selected < len(view.rows())-1 {
+			view.selected++
+		}
+	case "k", "\033[A", "\033OA":
+		if view.selected > 0 {
+			view.selected--
+		}
+	case "d":
+		view.drain()
+	case "x":
+		view.stop()
+	case "r":
+		view.refresh()
+	}
+	return false
+}
+
+func (view *topView) hostLine(host HostStatus, nameLen int) string {
+	capacity := host.Weight
+	if capacity < 1 {
+		capacity = 1
+	}
+	return fmt.Sprintf("%-*s %s %3d%% %3d/%-3d %s",
+		nameLen,
+		host.Name,
+		bar(len(host.Jobs), capacity),
+		len(host.Jobs)*100/capacity,
+		len(host.Jobs),
+		capacity,
+		hostLabel(host),
+	)
+}
+
+func (view *topView) jobLine(job JobStatus) string {
+	elapsed := "-"
+	if !job.Started.IsZero() {
+		elapsed = time.Since(job.Started).Truncate(time.Second).String()
+	}
+	speed := "-"
+	if job.Progress.Speed > 0 {
+		speed = fmt.Sprintf("%.2fx", job.Progress.Speed)
+	}
+	outTime := job.Progress.OutTime
+	if outTime == "" {
+		outTime = "-"
+	}
+	command := job.Command
+	if job.Instance != "" && job.Instance != view.instance {
+		command = "on " + job.Instance + ": " + command
+	}
+
+	return fmt.Sprintf("  PID %-8d %-9s %9s %7s %-15s %s",
+		job.Pid,
+		job.Class,
+		elapsed,
+		speed,
+		outTime,
+		command,
+	)
+}
+
+// render lays the view out for a terminal of the given size, the list of hosts and jobs is
+// scrolled to keep the selected row visible
+func (view *topView) render(width int, height int) string {
+	jobs := 0
+	nameLen := 10
+	for _, host := range view.hosts {
+		jobs += len(host.Jobs)
+		if len(host.Name) > nameLen {
+			nameLen = len(host.Name)
+		}
+	}
+
+	list := make([]string, 0)
+	for _, host := range view.hosts {
+		list = append(list, view.hostLine(host, nameLen))
+		for _, job := range host.Jobs {
+			list = append(list, view.jobLine(job))
+		}
+	}
+	if len(list) == 0 {
+		list = append(list, "no hosts, jobs run locally")
+	}
+
+	transitions := len(view.transitions)
+	if transitions > shownTransitions {
+		transitions = shownTransitions
+	}
+	// header, blank lines, transitions title, help and message
+	space := height - 6 - transitions
+	if space < 1 {
+		space = 1
+	}
+	if view.selected < view.offset {
+		view.offset = view.selected
+	}
+	if view.selected >= view.offset+space {
+		view.offset = view.selected - space + 1
+	}
+	if view.offset > len(list)-1 {
+		view.offset = 0
+	}
+	end := view.offset + space
+	if end > len(list) {
+		end = len(list)
+	}
+
+	fit := func(line string) string {
+		runes := []rune(line)
+		if len(runes) > width {
+			return string(runes[:width])
+		}
+		return line + strings.Repeat(" ", width-len(runes))
+	}
+
+	screen := strings.Builder{}
+	// the terminal is raw, lines need a carriage return and the rest of the old line cleared
+	write := func(style string, line string) {
+		if style == "" {
+			screen.WriteString(strings.TrimRight(fit(line), " "))
+		} else {
+			screen.WriteString(style + fit(line) + "\033[0m")
+		}
+		screen.WriteString("\033[K\r\n")
+	}
+
+	screen.WriteString("\033[H")
+	write("\033[1m", fmt.Sprintf("ffmpegof top - %s - %d hosts, %d jobs - %s",
+		view.instance,
+		len(view.hosts),
+		jobs,
+		view.refreshed.Format("15:04:05"),
+	))
+	write("", "")
+	for index := view.offset; index < end; index++ {
+		if index == view.selected && len(view.hosts) > 0 {
+			write("\033[7m", list[index])
+		} else {
+			write("", list[index])
+		}
+	}
+	write("", "")
+	write("\033[1m", "Recent transitions")
+	for index := len(view.transitions) - 1; index >= len(view.transitions)-transitions; index-- {
+		change := view.transitions[index]
+		write("", fmt.Sprintf("%s %s: %s -> %s", change.at.Format("15:04:05"), change.host, change.from, change.to))
+	}
+	write("\033[2m", "j/k select   d drain/undrain host   x stop job   r refresh   q quit")
+	screen.WriteString(strings.TrimRight(fit(view.message), " ") + "\033[K\033[J")
+	return screen.String()
+}
+
+// readKeys sends what is typed key by key. Keys typed quickly arrive in one read, escape
+// sequences of arrow keys are kept whole.
+func readKeys(in io.Reader, keys chan<- string) {
+	buffer := make([]byte, 32)
+	for {
+		n, err := in.Read(buffer)
+		if err != nil {
+			close(keys)
+			return
+		}
+		typed := buffer[:n]
+		for len(typed) > 0 {
+			size := 1
+			if typed[0] == '\033' && len(typed) >= 3 && (typed[1] == '[' || typed[1] == 'O') {
+				size = 3
+			}
+			keys <- string(typed[:size])
+			typed = typed[size:]
+		}
+	}
+}
+
+// top shows the status of the hosts until it is quit, refreshed every interval
+func top(proc *processor.Processor, instance string, info Top) error {
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		return fmt.Errorf("top needs a terminal, use status for scripts")
+	}
+	if info.Interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+
+	saved, err := term.MakeRaw(in)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(in, saved)
+	// the alternate screen keeps the scrollback as it was
+	fmt.Print("\033[?1049h\033[?25l")
+	defer fmt.Print("\033[?25h\033[?1049l")
+
+	keys := make(chan string)
+	go readKeys(os.Stdin, keys)
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(quit)
+	ticker := time.NewTicker(info.Interval)
+	defer ticker.Stop()
+
+	view := topView{proc: proc, instance: instance, info: info}
+	view.refresh()
+	for {
+		width, height, err := term.GetSize(out)
+		if err != nil {
+			width, height = 80, 24
+		}
+		fmt.Print(view.render(width, height))
+
+		select {
+		case <-ticker.C:
+			view.refresh()
+		case key, open := <-keys:
+			if !open || view.handle(key) {
+				return nil
+			}
+		case <-quit:
+			return nil
+		}
+	}
+}
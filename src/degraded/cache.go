@@ -0,0 +1,54 @@
+package degraded
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+
+	"github.com/tminaorg/ffmpegof/src/config"
+	"github.com/tminaorg/ffmpegof/src/inventory"
+	"github.com/tminaorg/ffmpegof/src/processor"
+)
+
+// saveCache writes the hosts of the datastore to the cache, in the format of
+// "ffmpegof hosts export". The file is only replaced when they changed.
+func saveCache(path string, proc *processor.Processor) error {
+	buffer := bytes.Buffer{}
+	if err := inventory.Export(proc, &buffer, "json"); err != nil {
+		return err
+	}
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, buffer.Bytes()) {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	// written aside and renamed, so degraded runs never read half a file
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(buffer.Bytes()); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(temp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+// loadCache reads the hosts of the cache
+func loadCache(path string) ([]config.Host, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return inventory.Read(file)
+}
@@ -0,0 +1,92 @@
+package degraded
+
+import (
+	"errors"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tminaorg/ffmpegof/src/config"
+	"github.com/tminaorg/ffmpegof/src/inventory"
+	"github.com/tminaorg/ffmpegof/src/processor"
+)
+
+// Processor stands in for the datastore which couldn't be set up because of cause. It keeps
+// everything in memory and starts with the hosts of the last-known-good cache, or the inventory
+// of the config if there's no cache, so the job can still run on one of them or locally.
+func Processor(config *config.Config, cause error) (*processor.Processor, error) {
+	proc, err := processor.New(processor.Config{DbType: "memory"})
+	if err != nil {
+		return nil, err
+	}
+
+	source := "none, running locally"
+	entries, err := loadCache(config.Degraded.Cache)
+	switch {
+	case err == nil:
+		source = config.Degraded.Cache
+	case errors.Is(err, os.ErrNotExist) && len(config.Hosts) > 0:
+		entries = config.Hosts
+		source = "config inventory"
+	case errors.Is(err, os.ErrNotExist):
+	default:
+		log.Error().Err(err).Str("cache", config.Degraded.Cache).Msg("failed reading host cache")
+	}
+
+	if len(entries) > 0 {
+		if _, err := inventory.Reconcile(proc, entries, inventory.Merge, false); err != nil {
+			log.Error().Err(err).Str("source", source).Msg("failed loading hosts, running locally")
+			source = "none, running locally"
+		}
+	}
+
+	log.Error().
+		Err(cause).
+		Str("hosts", source).
+		Str("journal", config.Degraded.Journal).
+		Msg("DATASTORE UNAVAILABLE, running in degraded mode: the load of other jobs is unknown and this job is journaled until the datastore is back")
+	return proc, nil
+}
+
+// Journal appends the jobs recorded by a degraded run to the journal, to be replayed into the
+// datastore by the first run that reaches it again
+func Journal(config *config.Config, proc *processor.Processor) {
+	jobs, err := proc.GetJobs(processor.JobFilter{})
+	if err != nil {
+		log.Error().Err(err).Msg("failed getting jobs of degraded run")
+		return
+	}
+	if err := appendJobs(config.Degraded.Journal, jobs); err != nil {
+		log.Error().Err(err).Str("journal", config.Degraded.Journal).Msg("failed journaling jobs, they are lost")
+	}
+}
+
+// Recover creates the host cache if there is none yet and replays the journal of degraded runs,
+// once the datastore is reachable. Both are skipped with a single stat when there's nothing to do.
+func Recover(config *config.Config, proc *processor.Processor) {
+	if !config.Degraded.Enabled {
+		return
+	}
+	if _, err := os.Stat(config.Degraded.Cache); errors.Is(err, os.ErrNotExist) {
+		Refresh(config, proc)
+	}
+
+	if _, err := os.Stat(config.Degraded.Journal); err != nil {
+		return
+	}
+	replayed, err := replay(config.Degraded.Journal, proc)
+	if err != nil {
+		log.Error().Err(err).Str("journal", config.Degraded.Journal).Msg("failed replaying journal of degraded runs")
+	} else if replayed > 0 {
+		log.Info().Int("jobs", replayed).Msg("reconciled jobs of degraded runs")
+	}
+}
+
+// Refresh copies the hosts of the datastore into the cache, after they were changed
+func Refresh(config *config.Config, proc *processor.Processor) {
+	if !config.Degraded.Enabled {
+		return
+	}
+	if err := saveCache(config.Degraded.Cache, proc); err != nil {
+		log.Warn().Err(err).Str("cache", config.Degraded.Cache).Msg("failed saving host cache")
+	}
+}
@@ -0,0 +1,120 @@
+package degraded
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tminaorg/ffmpegof/src/processor"
+)
+
+// appendJobs adds the jobs to the journal, one JSON object per line. They are written at once
+// on a file opened for appending, so runs journaling at the same time don't mix their lines.
+func appendJobs(path string, jobs []processor.Job) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	buffer := bytes.Buffer{}
+	encoder := json.NewEncoder(&buffer)
+	for _, job := range jobs {
+		if err := encoder.Encode(job); err != nil {
+			return err
+		}
+	}
+	return appendRaw(path, buffer.Bytes())
+}
+
+func appendRaw(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// replay inserts the jobs of the journal into the datastore and removes it. The journal is
+// claimed by renaming it first, so runs recovering at the same time don't insert it twice, and
+// put back if the jobs can't be inserted.
+func replay(path string, proc *processor.Processor) (int, error) {
+	claimed := fmt.Sprintf("%s.%d", path, os.Getpid())
+	if err := os.Rename(path, claimed); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	data, err := os.ReadFile(claimed)
+	if err != nil {
+		return 0, err
+	}
+
+	jobs := make([]processor.Job, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		job := processor.Job{}
+		if err := json.Unmarshal(scanner.Bytes(), &job); err != nil {
+			// a torn line would block the rest of the journal forever
+			log.Warn().Err(err).Int("line", line).Msg("skipping unreadable journal entry")
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	if err := insertJobs(proc, jobs); err != nil {
+		if restoreErr := appendRaw(path, data); restoreErr != nil {
+			return 0, fmt.Errorf("restore journal, kept at %s: %v: %w", claimed, restoreErr, err)
+		}
+		os.Remove(claimed)
+		return 0, err
+	}
+	return len(jobs), os.Remove(claimed)
+}
+
+// insertJobs adds the jobs in one transaction. Their host ids are those of the degraded run, so
+// the hosts are looked up again by name, jobs of hosts removed since keep only the name.
+func insertJobs(proc *processor.Processor, jobs []processor.Job) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	hosts, err := proc.GetHosts()
+	if err != nil {
+		return err
+	}
+	fallback, err := proc.GetFallbackHost()
+	if err != nil {
+		return err
+	}
+	ids := make(map[string]int, len(hosts)+1)
+	for _, host := range append(hosts, fallback) {
+		ids[host.Servername] = host.Id
+	}
+
+	return proc.Transaction(func(proc *processor.Processor) error {
+		for _, job := range jobs {
+			job.HostId = ids[job.Servername]
+			if err := proc.AddJob(job); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
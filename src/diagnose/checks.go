@@ -0,0 +1,391 @@
+package diagnose
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alessio/shellescape"
+	"github.com/tminaorg/ffmpegof/src/config"
+	"github.com/tminaorg/ffmpegof/src/processor"
+	"github.com/tminaorg/ffmpegof/src/transport"
+	"github.com/tminaorg/ffmpegof/src/worker"
+)
+
+// suffixes of the encoders using hardware acceleration
+var hardwareSuffixes = []string{"_vaapi", "_qsv", "_nvenc", "_amf", "_v4l2m2m", "_videotoolbox", "_rkmpp", "_omx"}
+
+func firstLine(out string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(out), "\n")
+	return strings.TrimSpace(line)
+}
+
+// user is who runs the jobs on the host, as far as ffmpegof knows
+func user(config *config.Config, r remote) string {
+	if r.transport.Name() == transport.Ssh {
+		return config.Remote.User
+	}
+	return "the user running ffmpeg"
+}
+
+// needs is the hint for a check that couldn't run, workers answer the checks themselves
+func needs(r remote, command string) string {
+	if r.worker != nil {
+		return "run the same version of ffmpegof on the worker as on the media server"
+	}
+	return "the host needs " + command
+}
+
+// transfers reports whether the worker ships the files, so the host needs no shared storage
+func transfers(config *config.Config, r remote) bool {
+	return r.transport.Name() == transport.Worker && config.Worker.Transfer
+}
+
+func connectivity(config *config.Config, host processor.Host, r remote) Check {
+	check := Check{Name: "connectivity"}
+
+	started := time.Now()
+	out, err := r.echo()
+	elapsed := time.Since(started)
+	if err == nil && !strings.Contains(out, "ffmpegof") {
+		err = fmt.Errorf("unexpected answer %q", firstLine(out))
+	}
+	if err == nil {
+		check.Status = Pass
+		check.Detail = fmt.Sprintf("reached over %s in %s", r.transport.Name(), elapsed.Round(time.Millisecond))
+		return check
+	}
+
+	check.Status = Fail
+	check.Detail = err.Error()
+	command := strings.Join(r.transport.Command(r.target, []string{"echo", "ffmpegof"}), " ")
+	switch r.transport.Name() {
+	case transport.Ssh:
+		check.Hint = fmt.Sprintf("check that %s@%s accepts the key in remote.args and that it is readable, try: %s", config.Remote.User, host.Hostname, command)
+	case transport.Docker, transport.Podman:
+		check.Hint = fmt.Sprintf("check that the container %s runs, try: %s", host.Hostname, command)
+	case transport.Kubectl:
+		check.Hint = fmt.Sprintf("check that the pod %s runs and may be exec'd into, try: %s", host.Hostname, command)
+	case transport.Worker:
+		check.Hint = fmt.Sprintf("check that \"ffmpegof worker serve\" runs on %s and that both sides trust worker.ca, try: ffmpegof worker info %s", host.Hostname, host.Hostname)
+	default:
+		check.Hint = "try: " + command
+	}
+	return check
+}
+
+// latency is the median round trip of a command once connected, every job waits for it
+func latency(config *config.Config, r remote) Check {
+	check := Check{Name: "latency"}
+
+	rounds := make([]time.Duration, 0, 3)
+	for index := 0; index < 3; index++ {
+		started := time.Now()
+		if _, err := r.echo(); err != nil {
+			check.Status = Fail
+			check.Detail = err.Error()
+			check.Hint = "the connection is unstable, check the network to the host"
+			return check
+		}
+		rounds = append(rounds, time.Since(started))
+	}
+	sort.Slice(rounds, func(i, j int) bool {
+		return rounds[i] < rounds[j]
+	})
+
+	median := rounds[len(rounds)/2]
+	check.Status = Pass
+	check.Detail = fmt.Sprintf("%s per command, median of %d", median.Round(time.Millisecond), len(rounds))
+	if median > time.Duration(config.Test.MaxLatency)*time.Millisecond {
+		check.Status = Warn
+		check.Detail += fmt.Sprintf(", above test.max_latency of %dms", config.Test.MaxLatency)
+		check.Hint = "every job waits for this before ffmpeg starts; keep remote.persist enabled for ssh and check the network to the host"
+	}
+	return check
+}
+
+// versionOf returns the version from the first line of "ffmpeg -version", or the line
+func versionOf(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) >= 3 && fields[1] == "version" {
+		return fields[2]
+	}
+	return line
+}
+
+// version runs the binary on the host and compares its version with the one of the media
+// server, whose commands are built for its own version
+func version(name string, setting string, path string, localPath string, r remote) Check {
+	check := Check{Name: name}
+
+	out, err := r.run(path, "-version")
+	if err != nil {
+		check.Status = Fail
+		check.Detail = fmt.Sprintf("%s: %s", path, err)
+		check.Hint = fmt.Sprintf("install %s at %s on the host, or set %s to its path", name, path, setting)
+		return check
+	}
+	remoteVersion := versionOf(firstLine(out))
+	check.Status = Pass
+	check.Detail = fmt.Sprintf("%s %s", path, remoteVersion)
+
+	if out, err := exec.Command(localPath, "-version").Output(); err == nil {
+		if localVersion := versionOf(firstLine(string(out))); localVersion != remoteVersion {
+			check.Status = Warn
+			check.Detail += fmt.Sprintf(", the media server has %s", localVersion)
+			check.Hint = "install the same build as on the media server, its arguments may not be understood by another version"
+		}
+	}
+	return check
+}
+
+// capability lists what ffmpeg supports and fails when something required is missing
+func capability(name string, setting string, required []string, available []string, shown []string) Check {
+	check := Check{Name: name}
+
+	has := make(map[string]bool, len(available))
+	for _, item := range available {
+		has[item] = true
+	}
+	missing := make([]string, 0)
+	for _, item := range required {
+		if !has[item] {
+			missing = append(missing, item)
+		}
+	}
+
+	list := "none"
+	if len(shown) > 0 {
+		list = strings.Join(shown, ", ")
+	}
+	if len(missing) > 0 {
+		check.Status = Fail
+		check.Detail = "missing " + strings.Join(missing, ", ")
+		check.Hint = fmt.Sprintf("install an ffmpeg build supporting them, like jellyfin-ffmpeg, and the drivers of the GPU, or adjust %s", setting)
+		return check
+	}
+	check.Status = Pass
+	check.Detail = list
+	return check
+}
+
+func encoders(config *config.Config, ffmpeg Check, r remote) Check {
+	if ffmpeg.Status == Fail {
+		return Check{Name: "encoders", Status: Skip, Detail: "ffmpeg unavailable"}
+	}
+	out, err := r.run(config.Commands.Ffmpeg, "-hide_banner", "-encoders")
+	if err != nil {
+		return Check{Name: "encoders", Status: Fail, Detail: err.Error(), Hint: "run ffmpeg -encoders on the host to see why it fails"}
+	}
+
+	available := worker.ParseEncoders(out)
+	// software encoders are always there, the hardware ones tell whether the GPU can be used
+	hardware := make([]string, 0)
+	for _, encoder := range available {
+		for _, suffix := range hardwareSuffixes {
+			if strings.HasSuffix(encoder, suffix) {
+				hardware = append(hardware, encoder)
+				break
+			}
+		}
+	}
+	check := capability("encoders", "test.encoders", config.Test.Encoders, available, hardware)
+	if check.Status == Pass {
+		check.Detail = fmt.Sprintf("%d, hardware: %s", len(available), check.Detail)
+	}
+	return check
+}
+
+func hwaccels(config *config.Config, ffmpeg Check, r remote) Check {
+	if ffmpeg.Status == Fail {
+		return Check{Name: "hwaccels", Status: Skip, Detail: "ffmpeg unavailable"}
+	}
+	out, err := r.run(config.Commands.Ffmpeg, "-hide_banner", "-hwaccels")
+	if err != nil {
+		return Check{Name: "hwaccels", Status: Fail, Detail: err.Error(), Hint: "run ffmpeg -hwaccels on the host to see why it fails"}
+	}
+
+	available := worker.ParseHwaccels(out)
+	return capability("hwaccels", "test.hwaccels", config.Test.Hwaccels, available, available)
+}
+
+// device checks the render node used by vaapi and qsv, only required when hwaccels are
+func device(config *config.Config, r remote) Check {
+	check := Check{Name: "render device"}
+	if config.Test.Device == "" {
+		check.Status = Skip
+		check.Detail = "test.device is empty"
+		return check
+	}
+
+	out, err := r.probe(worker.DiagnoseDevice, fmt.Sprintf(
+		`d=%s; if [ ! -e "$d" ]; then echo missing; elif [ ! -c "$d" ]; then echo other; elif [ -r "$d" ] && [ -w "$d" ]; then echo usable; else echo denied; fi`,
+		shellescape.Quote(config.Test.Device),
+	), config.Test.Device)
+	if err != nil {
+		check.Status = Fail
+		check.Detail = err.Error()
+		check.Hint = needs(r, "a POSIX sh")
+		return check
+	}
+
+	switch firstLine(out) {
+	case "usable":
+		check.Status = Pass
+		check.Detail = config.Test.Device + " is usable"
+	case "denied":
+		check.Status = Fail
+		check.Detail = fmt.Sprintf("%s isn't readable and writable by %s", config.Test.Device, user(config, r))
+		check.Hint = "add the user to the group owning the device, usually render or video"
+	default:
+		check.Status = Warn
+		if len(config.Test.Hwaccels) > 0 {
+			check.Status = Fail
+		}
+		check.Detail = fmt.Sprintf("%s doesn't exist or isn't a device, hardware acceleration won't work", config.Test.Device)
+		switch r.transport.Name() {
+		case transport.Docker, transport.Podman:
+			check.Hint = fmt.Sprintf("pass the device into the container, e.g. with --device %s", config.Test.Device)
+		case transport.Kubectl:
+			check.Hint = "request the GPU in the pod spec through the device plugin of its vendor"
+		default:
+			check.Hint = "install the driver of the GPU, or set test.device to its render node, or to nothing for software transcoding"
+		}
+	}
+	return check
+}
+
+// media checks that the libraries are readable at the paths the media server passes to ffmpeg
+func media(config *config.Config, r remote) Check {
+	check := Check{Name: "media"}
+	switch {
+	case transfers(config, r):
+		check.Status = Skip
+		check.Detail = "worker.transfer ships the files"
+		return check
+	case len(config.Test.Media) == 0:
+		check.Status = Skip
+		check.Detail = "test.media is empty"
+		return check
+	}
+
+	script := strings.Builder{}
+	for _, path := range config.Test.Media {
+		fmt.Fprintf(&script,
+			`p=%s; if [ ! -e "$p" ]; then echo "missing $p"; elif [ ! -r "$p" ] || { [ -d "$p" ] && [ ! -x "$p" ]; }; then echo "unreadable $p"; fi; `,
+			shellescape.Quote(path),
+		)
+	}
+	out, err := r.probe(worker.DiagnoseMedia, script.String(), config.Test.Media...)
+	if err != nil {
+		check.Status = Fail
+		check.Detail = err.Error()
+		check.Hint = needs(r, "a POSIX sh")
+		return check
+	}
+
+	if strings.TrimSpace(out) != "" {
+		check.Status = Fail
+		check.Detail = strings.ReplaceAll(strings.TrimSpace(out), "\n", ", ")
+		check.Hint = fmt.Sprintf("mount the media at the same paths as on the media server, e.g. over NFS, readable by %s", user(config, r))
+		return check
+	}
+	check.Status = Pass
+	check.Detail = strings.Join(config.Test.Media, ", ") + " readable"
+	return check
+}
+
+// transcodes checks that the transcodes directory is writable and is the one of the media
+// server, by looking for a file written to it here
+func transcodes(config *config.Config, r remote) Check {
+	check := Check{Name: "transcodes"}
+	switch {
+	case transfers(config, r):
+		check.Status = Skip
+		check.Detail = "worker.transfer ships the files"
+		return check
+	case config.Test.Transcodes == "":
+		check.Status = Skip
+		check.Detail = "test.transcodes is empty"
+		return check
+	}
+
+	script := fmt.Sprintf(
+		`d=%s; if [ ! -d "$d" ]; then echo missing; exit 0; fi; f="$d/.ffmpegof-test-$$"; if ! ( : > "$f" ) 2>/dev/null; then echo readonly; exit 0; fi; rm -f "$f"; echo writable`,
+		shellescape.Quote(config.Test.Transcodes),
+	)
+	paths := []string{config.Test.Transcodes}
+	marker, markerErr := os.CreateTemp(config.Test.Transcodes, ".ffmpegof-test-*")
+	if markerErr == nil {
+		marker.Close()
+		defer os.Remove(marker.Name())
+		script += fmt.Sprintf(`; if [ -e %s ]; then echo shared; fi`, shellescape.Quote(marker.Name()))
+		paths = append(paths, marker.Name())
+	}
+
+	out, err := r.probe(worker.DiagnoseTranscodes, script, paths...)
+	if err != nil {
+		check.Status = Fail
+		check.Detail = err.Error()
+		check.Hint = needs(r, "a POSIX sh")
+		return check
+	}
+
+	switch {
+	case strings.Contains(out, "missing"):
+		check.Status = Fail
+		check.Detail = config.Test.Transcodes + " doesn't exist"
+		check.Hint = fmt.Sprintf("mount the transcodes directory of the media server at %s, or set test.transcodes to it", config.Test.Transcodes)
+	case strings.Contains(out, "readonly"):
+		check.Status = Fail
+		check.Detail = fmt.Sprintf("%s isn't writable by %s", config.Test.Transcodes, user(config, r))
+		check.Hint = "give the user write access, e.g. by running it with the uid of the media server"
+	case strings.Contains(out, "shared"):
+		check.Status = Pass
+		check.Detail = config.Test.Transcodes + " is writable and shared with the media server"
+	case markerErr != nil:
+		check.Status = Warn
+		check.Detail = fmt.Sprintf("%s is writable, but whether it is shared wasn't checked: %s", config.Test.Transcodes, markerErr)
+		check.Hint = "run ffmpegof test as the user of the media server, with test.transcodes set to its transcodes directory"
+	default:
+		check.Status = Fail
+		check.Detail = config.Test.Transcodes + " is writable, but isn't the directory of the media server, a file written there here isn't visible"
+		check.Hint = fmt.Sprintf("mount the transcodes directory of the media server at %s on the host", config.Test.Transcodes)
+	}
+	return check
+}
+
+// clock compares the clocks, date only reports whole seconds so the skew is known within half a second
+func clock(config *config.Config, r remote) Check {
+	check := Check{Name: "clock"}
+
+	before := time.Now()
+	out, err := r.clock()
+	after := time.Now()
+	if err == nil {
+		var seconds int64
+		seconds, err = strconv.ParseInt(firstLine(out), 10, 64)
+		if err == nil {
+			remote := time.Unix(seconds, int64(time.Second/2))
+			skew := remote.Sub(before.Add(after.Sub(before) / 2))
+
+			check.Status = Pass
+			check.Detail = fmt.Sprintf("%+.1fs from the media server", skew.Seconds())
+			if skew.Abs() > time.Duration(config.Test.MaxSkew)*time.Second {
+				check.Status = Fail
+				check.Detail += fmt.Sprintf(", above test.max_skew of %ds", config.Test.MaxSkew)
+				check.Hint = "enable time synchronisation on both, e.g. with timedatectl set-ntp true, skewed clocks distort job times and segment timestamps"
+			}
+			return check
+		}
+	}
+
+	check.Status = Fail
+	check.Detail = err.Error()
+	check.Hint = needs(r, "date")
+	return check
+}
@@ -0,0 +1,168 @@
+package diagnose
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tminaorg/ffmpegof/src/config"
+	"github.com/tminaorg/ffmpegof/src/processor"
+	"github.com/tminaorg/ffmpegof/src/transport"
+	"github.com/tminaorg/ffmpegof/src/worker"
+)
+
+// Outcomes of a check
+const (
+	Pass = "pass"
+	Warn = "warn"
+	Fail = "fail"
+	Skip = "skip"
+)
+
+// commands that don't answer in time count as failed, so a hung host can't block the suite
+const commandTimeout = 15 * time.Second
+
+// Check is one test of the suite, Hint tells how to fix a warning or failure
+type Check struct {
+	Name   string
+	Status string
+	Detail string
+	Hint   string
+}
+
+// Report is the outcome of the suite on a host
+type Report struct {
+	Host   processor.Host
+	Checks []Check
+}
+
+// Count returns the number of checks with the status
+func (report Report) Count(status string) int {
+	count := 0
+	for _, check := range report.Checks {
+		if check.Status == status {
+			count++
+		}
+	}
+	return count
+}
+
+// remote runs commands on the host the way jobs are run on it, workers only run ffmpeg so
+// they answer the other checks themselves
+type remote struct {
+	transport transport.Transport
+	target    string
+	worker    *worker.Client
+}
+
+// run returns the stdout of the command, the last line of its stderr is added to a failure
+func (r remote) run(command ...string) (string, error) {
+	stdout, stderr := bytes.Buffer{}, bytes.Buffer{}
+	process, err := r.transport.Start(r.target, command, transport.Stdio{
+		Stdin:  nil,
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- process.Wait()
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(commandTimeout):
+		if killErr := process.Signal(os.Kill); killErr == nil {
+			<-done
+		}
+		return stdout.String(), fmt.Errorf("no answer within %s", commandTimeout)
+	}
+
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+			return stdout.String(), fmt.Errorf("%w: %s", err, last)
+		}
+		return stdout.String(), err
+	}
+	return stdout.String(), nil
+}
+
+// shell runs a script with the POSIX shell of the host
+func (r remote) shell(script string) (string, error) {
+	return r.run("sh", "-c", script)
+}
+
+// probe runs the check on a worker, or its script on other hosts, both print the same
+func (r remote) probe(check string, script string, paths ...string) (string, error) {
+	if r.worker != nil {
+		return r.worker.Diagnose(check, paths...)
+	}
+	return r.shell(script)
+}
+
+func (r remote) echo() (string, error) {
+	if r.worker != nil {
+		return r.worker.Diagnose(worker.DiagnoseEcho)
+	}
+	return r.run("echo", "ffmpegof")
+}
+
+// clock returns the unix time of the host
+func (r remote) clock() (string, error) {
+	if r.worker != nil {
+		return r.worker.Diagnose(worker.DiagnoseClock)
+	}
+	return r.run("date", "+%s")
+}
+
+// Run tests the host through its transport, or this machine for the fallback and hosts named
+// localhost, like jobs do. Once the host can't be reached, the other checks are skipped.
+func Run(config *config.Config, host processor.Host) Report {
+	report := Report{Host: host, Checks: make([]Check, 0)}
+
+	r := remote{transport: transport.Local(), target: "localhost"}
+	if !host.Fallback && host.Hostname != "localhost" && host.Hostname != "127.0.0.1" && host.Hostname != "::1" {
+		hostTransport, err := transport.New(host.Transport, config)
+		if err != nil {
+			report.Checks = append(report.Checks, Check{
+				Name:   "connectivity",
+				Status: Fail,
+				Detail: err.Error(),
+				Hint:   fmt.Sprintf("change the transport with: ffmpegof edit %s --transport <%s>", host.Servername, strings.Join(transport.Names, "|")),
+			})
+			return report
+		}
+		r = remote{transport: hostTransport, target: host.Hostname}
+		if hostTransport.Name() == transport.Worker {
+			r.worker = worker.NewClient(config, host.Hostname)
+		}
+	}
+
+	connected := connectivity(config, host, r)
+	report.Checks = append(report.Checks, connected)
+	if connected.Status == Fail {
+		for _, name := range []string{"latency", "ffmpeg", "ffprobe", "encoders", "hwaccels", "render device", "media", "transcodes", "clock"} {
+			report.Checks = append(report.Checks, Check{Name: name, Status: Skip, Detail: "host unreachable"})
+		}
+		return report
+	}
+
+	ffmpeg := version("ffmpeg", "commands.ffmpeg", config.Commands.Ffmpeg, config.Commands.FallbackFfmpeg, r)
+	report.Checks = append(report.Checks,
+		latency(config, r),
+		ffmpeg,
+		version("ffprobe", "commands.ffprobe", config.Commands.Ffprobe, config.Commands.FallbackFfprobe, r),
+		encoders(config, ffmpeg, r),
+		hwaccels(config, ffmpeg, r),
+		device(config, r),
+		media(config, r),
+		transcodes(config, r),
+		clock(config, r),
+	)
+	return report
+}
@@ -1,102 +1,74 @@
 package ffmpeg
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/sourcegraph/conc"
 	"github.com/tminaorg/ffmpegof/src/config"
+	"github.com/tminaorg/ffmpegof/src/degraded"
+	"github.com/tminaorg/ffmpegof/src/inventory"
 	"github.com/tminaorg/ffmpegof/src/processor"
-	"github.com/alessio/shellescape"
+	"github.com/tminaorg/ffmpegof/src/reaper"
+	"github.com/tminaorg/ffmpegof/src/transport"
 )
 
 // signum="", frame=""
-func cleanup(pid int, proc *processor.Processor) (error, error) {
+func cleanup(config *config.Config, proc *processor.Processor) (error, error) {
 	errStates := make(chan error, 1)
 	errProcesses := make(chan error, 1)
 	var worker conc.WaitGroup
+	// the same PID may be running in another instance sharing the database
 	worker.Go(func() {
-		errStates <- proc.RemoveStatesByField("process_id", processor.State{ProcessId: pid})
+		errStates <- proc.RemoveStatesOfInstance(processor.State{
+			ProcessId: config.Program.Pid,
+			Instance:  config.Program.Instance,
+		})
 	})
 	worker.Go(func() {
-		errProcesses <- proc.RemoveProcessesByField("process_id", processor.Process{ProcessId: pid})
+		errProcesses <- proc.RemoveProcessesOfInstance(processor.Process{
+			ProcessId: config.Program.Pid,
+			Instance:  config.Program.Instance,
+		})
 	})
 	return <-errStates, <-errProcesses
 }
 
-func generateSshCommand(config *config.Config, targetHostname string) []string {
-	sshCommand := make([]string, 0)
-
-	// Add SSH component
-	sshCommand = append(sshCommand, config.Commands.Ssh)
-	if !config.Program.Debug {
-		sshCommand = append(sshCommand, "-q")
-	}
-	sshCommand = append(sshCommand, "-t")
-
-	// Set our connection details
-	sshCommand = append(sshCommand, []string{"-o", "ConnectTimeout=1"}...)
-	sshCommand = append(sshCommand, []string{"-o", "ConnectionAttempts=1"}...)
-	sshCommand = append(sshCommand, []string{"-o", "StrictHostKeyChecking=no"}...)
-	sshCommand = append(sshCommand, []string{"-o", "UserKnownHostsFile=/dev/null"}...)
-
-	// Use SSH control persistence to keep sessions alive for subsequent commands
-	if config.Remote.Persist > 0 {
-		sshCommand = append(sshCommand, []string{"-o", "ControlMaster=auto"}...)
-		sshCommand = append(sshCommand, []string{"-o", fmt.Sprintf("ControlPath=%s", config.Directories.Persist) + "/ssh-%%r@%%h:%%p"}...)
-		sshCommand = append(sshCommand, []string{"-o", fmt.Sprintf("ControlPersist=%d", config.Remote.Persist)}...)
-	}
-
-	// Add the remote config args
-	sshCommand = append(sshCommand, config.Remote.Args...)
-
-	// Add user+host string
-	sshCommand = append(sshCommand, fmt.Sprintf("%s@%s", config.Remote.User, targetHostname))
-
-	return sshCommand
-}
-
-func runCommand(commandArray []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) *exec.Cmd {
-	commandName := commandArray[0]
-	commandArgs := commandArray[1:]
-	cmd := exec.Command(commandName, commandArgs...)
-	cmd.Stdin = stdin
-	cmd.Stdout = stdout
-	cmd.Stderr = stderr
-	return cmd
-}
-
-func removeFromSlice(slice []string, elemToRemove string) []string {
-	for index, elem := range slice {
-		if elem == elemToRemove {
-			return append(slice[:index], slice[index+1:]...)
-		}
-	}
-	return slice
-}
-
-func getStateAndPid(proc *processor.Processor, host processor.Host) (string, string, error) {
+func getStateAndPid(proc *processor.Processor, host processor.Host) (string, string, bool, bool, error) {
 	currentState := "idle"
 	markingPid := "N/A"
+	suspect := false
+	drained := false
 
 	states, err := proc.GetStatesFromHost(host)
 	if err != nil {
-		return currentState, markingPid, err
+		return currentState, markingPid, suspect, drained, err
 	}
 
-	if len(states) != 0 {
-		currentState = states[0].State
-		markingPid = fmt.Sprintf("%d", states[0].ProcessId)
+	// suspect and drained states outlive the processes, so they don't count as the current state
+	found := false
+	for _, state := range states {
+		if state.State == "suspect" {
+			suspect = true
+		} else if state.State == "drained" {
+			drained = true
+		} else if !found {
+			currentState = state.State
+			markingPid = fmt.Sprintf("%d", state.ProcessId)
+			found = true
+		}
 	}
 
-	return currentState, markingPid, nil
+	return currentState, markingPid, suspect, drained, nil
 }
 
 func getCommands(proc *processor.Processor, host processor.Host) ([]int, error) {
@@ -120,11 +92,15 @@ func getHostMapping(proc *processor.Processor, host processor.Host) (HostMapping
 
 	currentStateC := make(chan string, 1)
 	markingPidC := make(chan string, 1)
+	suspectC := make(chan bool, 1)
+	drainedC := make(chan bool, 1)
 	errStateAndPidC := make(chan error, 1)
 	worker.Go(func() {
-		currentState, markingPid, errStateAndPid := getStateAndPid(proc, host)
+		currentState, markingPid, suspect, drained, errStateAndPid := getStateAndPid(proc, host)
 		currentStateC <- currentState
 		markingPidC <- markingPid
+		suspectC <- suspect
+		drainedC <- drained
 		errStateAndPidC <- errStateAndPid
 	})
 
@@ -150,8 +126,11 @@ func getHostMapping(proc *processor.Processor, host processor.Host) (HostMapping
 		Hostname:     host.Hostname,
 		Weight:       host.Weight,
 		Servername:   host.Servername,
+		Transport:    host.Transport,
 		CurrentState: <-currentStateC,
 		MarkingPid:   <-markingPidC,
+		Suspect:      <-suspectC,
+		Drained:      <-drainedC,
 		Commands:     <-commandsC,
 	}
 	return hostMapping, nil
@@ -184,25 +163,26 @@ func getHostMappings(proc *processor.Processor, hosts []processor.Host) ([]HostM
 	return hostMappings, nil
 }
 
-func getTargetHost(config *config.Config, proc *processor.Processor) (processor.Host, error) {
-	targetHost := processor.Host{
-		Id:         0,
-		Servername: "localhost (fallback)",
-		Hostname:   "localhost",
-		Weight:     0,
+// getTargetHost also returns the number of hosts that failed their health check
+func getTargetHost(config *config.Config, proc *processor.Processor) (processor.Host, int, error) {
+	targetHost, err := proc.GetFallbackHost()
+	if err != nil {
+		return targetHost, 0, err
 	}
 
 	hosts, err := proc.GetHosts()
 	if err != nil || len(hosts) == 0 {
-		return targetHost, err
+		return targetHost, 0, err
 	}
 
 	hostMappings, err := getHostMappings(proc, hosts)
 	if err != nil {
-		return targetHost, err
+		return targetHost, 0, err
 	}
 
+	retries := 0
 	lowestCount := 9999
+	suspects := make([]HostMapping, 0)
 	for _, hostMapping := range hostMappings {
 		log.Debug().Str("host", hostMapping.Servername).Msg("trying")
 
@@ -211,24 +191,25 @@ func getTargetHost(config *config.Config, proc *processor.Processor) (processor.
 			continue
 		}
 
+		// Drained hosts finish their jobs but don't get new ones
+		if hostMapping.Drained {
+			log.Debug().Msg("host drained")
+			continue
+		}
+
 		if hostMapping.Hostname != "localhost" && hostMapping.Hostname != "127.0.0.1" {
-			log.Debug().Msg("running ssh test")
+			log.Debug().Str("transport", hostMapping.Transport).Msg("running transport test")
 
 			// we need to wait for everything to be done
 			wg := sync.WaitGroup{}
 			wg.Add(2)
+			failed := false
 
 			go func() {
 				defer wg.Done()
 				pipeReader, pipeWriter := io.Pipe()
 				defer pipeWriter.Close()
 
-				testSshCommand := generateSshCommand(config, hostMapping.Hostname)
-				testSshCommand = removeFromSlice(testSshCommand, "-q")
-				testFfmpegCommand := config.Commands.Ffmpeg + " -version"
-				testFullCommand := append(testSshCommand, testFfmpegCommand)
-				testCommand := runCommand(testFullCommand, os.Stdin, pipeWriter, pipeWriter)
-
 				go func() {
 					defer wg.Done()
 					defer pipeReader.Close()
@@ -238,31 +219,59 @@ func getTargetHost(config *config.Config, proc *processor.Processor) (processor.
 					}
 				}()
 
-				if err := testCommand.Run(); err != nil {
+				testFfmpegCommand := []string{config.Commands.Ffmpeg, "-version"}
+				testTransport, err := transport.New(hostMapping.Transport, config)
+				if err == nil {
+					err = transport.Run(testTransport, hostMapping.Hostname, testFfmpegCommand, transport.Stdio{
+						// the probe must never consume what the media server writes to the job
+						Stdin:  nil,
+						Stdout: pipeWriter,
+						Stderr: pipeWriter,
+					})
+				}
+
+				if err != nil {
 					// Mark the host as bad
 					log.Warn().
 						Err(err).
 						Str("host", hostMapping.Servername).
-						Str("command", strings.Join(testFullCommand, " ")).
+						Str("transport", hostMapping.Transport).
+						Str("command", strings.Join(testFfmpegCommand, " ")).
 						Msg("marking as bad")
+					failed = true
+					retries++
 
 					err := proc.AddState(processor.State{
 						HostId:    hostMapping.Id,
 						ProcessId: config.Program.Pid,
+						BootId:    config.Program.BootId,
+						Instance:  config.Program.Instance,
+						PidStart:  config.Program.PidStart,
 						State:     "bad",
 					})
 					if err != nil {
 						log.Error().
 							Err(err).
 							Str("host", hostMapping.Servername).
-							Str("command", strings.Join(testFullCommand, " ")).
+							Str("command", strings.Join(testFfmpegCommand, " ")).
 							Msg("failed to mark host as bad")
 					}
 					return
 				}
-				log.Debug().Msg("ssh test succeeded")
+				log.Debug().Msg("transport test succeeded")
 			}()
 			wg.Wait()
+
+			if failed {
+				continue
+			}
+		}
+
+		// Hosts whose jobs stalled before are only used if nothing else is left
+		if hostMapping.Suspect {
+			log.Debug().Msg("host previously marked suspect")
+			suspects = append(suspects, hostMapping)
+			continue
 		}
 
 		// If the host state is idle, we can use it immediately
@@ -270,6 +279,8 @@ func getTargetHost(config *config.Config, proc *processor.Processor) (processor.
 			targetHost.Id = hostMapping.Id
 			targetHost.Servername = hostMapping.Servername
 			targetHost.Hostname = hostMapping.Hostname
+			targetHost.Transport = hostMapping.Transport
+			targetHost.Fallback = false
 			log.Debug().Msg("selecting host as idle")
 			break
 		}
@@ -284,6 +295,8 @@ func getTargetHost(config *config.Config, proc *processor.Processor) (processor.
 			targetHost.Id = hostMapping.Id
 			targetHost.Servername = hostMapping.Servername
 			targetHost.Hostname = hostMapping.Hostname
+			targetHost.Transport = hostMapping.Transport
+			targetHost.Fallback = false
 			log.Debug().
 				Str("raw", fmt.Sprintf("%d", rawProcCount)).
 				Str("weighted", fmt.Sprintf("%d", weightedProcCount)).
@@ -291,12 +304,27 @@ func getTargetHost(config *config.Config, proc *processor.Processor) (processor.
 		}
 	}
 
+	if targetHost.Fallback {
+		for _, hostMapping := range suspects {
+			weightedProcCount := len(hostMapping.Commands) / hostMapping.Weight
+			if weightedProcCount < lowestCount {
+				lowestCount = weightedProcCount
+				targetHost.Id = hostMapping.Id
+				targetHost.Servername = hostMapping.Servername
+				targetHost.Hostname = hostMapping.Hostname
+				targetHost.Transport = hostMapping.Transport
+				targetHost.Fallback = false
+				log.Warn().Str("host", hostMapping.Servername).Msg("no other host left, selecting suspect host")
+			}
+		}
+	}
+
 	log.Debug().
 		Str("id", fmt.Sprintf("%d", targetHost.Id)).
 		Str("servername", targetHost.Servername).
 		Str("hostname", targetHost.Hostname).
 		Msg("found optimal host")
-	return targetHost, err
+	return targetHost, retries, err
 }
 
 func sliceContains(slice []string, elem string) bool {
@@ -308,15 +336,82 @@ func sliceContains(slice []string, elem string) bool {
 	return false
 }
 
-func runLocalFfmpeg(config *config.Config, proc *processor.Processor, cmd string, args []string) (error, error, error) {
+// usesPipes reports whether ffmpeg reads an input from stdin and whether it writes an output to stdout
+func usesPipes(args []string) (bool, bool) {
+	stdinPipe := false
+	stdoutPipe := false
+	for index, arg := range args {
+		input := index > 0 && args[index-1] == "-i"
+		switch {
+		case input && (arg == "-" || arg == "pipe:" || arg == "pipe:0"):
+			stdinPipe = true
+		case !input && (arg == "pipe:" || arg == "pipe:1"):
+			stdoutPipe = true
+		case !input && arg == "-" && index == len(args)-1:
+			stdoutPipe = true
+		}
+	}
+	return stdinPipe, stdoutPipe
+}
+
+// recordActive adds the process and the active state the load of the target is counted from,
+// before ffmpeg starts. When they can't be added, database.on_failure decides whether the job
+// runs anyway, unaccounted for, or is refused.
+func recordActive(config *config.Config, proc *processor.Processor, target processor.Host, fullCommand string) error {
+	var worker conc.WaitGroup
+
+	errProcessC := make(chan error, 1)
+	started := time.Now()
+	worker.Go(func() {
+		errProcessC <- proc.AddProcess(processor.Process{
+			HostId:    target.Id,
+			ProcessId: config.Program.Pid,
+			BootId:    config.Program.BootId,
+			Instance:  config.Program.Instance,
+			PidStart:  config.Program.PidStart,
+			Cmd:       fullCommand,
+			Started:   started,
+			Updated:   started,
+		})
+	})
+
+	errStateC := make(chan error, 1)
+	worker.Go(func() {
+		errStateC <- proc.AddState(processor.State{
+			HostId:    target.Id,
+			ProcessId: config.Program.Pid,
+			BootId:    config.Program.BootId,
+			Instance:  config.Program.Instance,
+			PidStart:  config.Program.PidStart,
+			State:     "active",
+		})
+	})
+
+	worker.Wait()
+	errProcess, errState := <-errProcessC, <-errStateC
+	if errProcess != nil {
+		log.Error().Err(errProcess).Msg("failed adding process")
+	}
+	if errState != nil {
+		log.Error().Err(errState).Msg("failed adding state")
+	}
+
+	err := errors.Join(errProcess, errState)
+	if err != nil && config.Database.OnFailure == "refuse" {
+		return fmt.Errorf("refusing to run a job that can't be recorded: %w", err)
+	}
+	return nil
+}
+
+func runLocalFfmpeg(config *config.Config, proc *processor.Processor, cmd string, args []string, target processor.Host, job *job) error {
 	ffmpegofFfmpegCommand := make([]string, 0)
 
 	// Prepare our default stdin/stdout/stderr
-	stdin := os.Stdin
-	stdout := os.Stdout
-	stderr := os.Stderr
+	stdin := job.stdin.reader
+	var stdout io.Writer = os.Stdout
+	stderr := job.stderr(os.Stderr)
 
-	if strings.Contains(cmd, "ffprobe") {
+	if strings.Contains(filepath.Base(cmd), "ffprobe") {
 		// If we're in ffprobe mode use that command and os.Stdout as stdout
 		ffmpegofFfmpegCommand = append(ffmpegofFfmpegCommand, config.Commands.Ffprobe)
 	} else {
@@ -336,47 +431,42 @@ func runLocalFfmpeg(config *config.Config, proc *processor.Processor, cmd string
 		}
 	}
 
+	// Output written to pipe:1 has to reach the real stdout
+	if _, stdoutPipe := usesPipes(args); stdoutPipe {
+		stdout = os.Stdout
+	}
+
 	log.Info().Msg("running command on localhost")
 	log.Debug().Str("command", strings.Join(ffmpegofFfmpegCommand, " ")).Msg("localhost")
 
-	var worker conc.WaitGroup
-
-	errProcessC := make(chan error, 1)
-	fullCommand := cmd + " " + strings.Join(args, " ")
-	worker.Go(func() {
-		errProcessC <- proc.AddProcess(processor.Process{
-			HostId:    0,
-			ProcessId: config.Program.Pid,
-			Cmd:       fullCommand,
-		})
-	})
+	if err := recordActive(config, proc, target, cmd+" "+strings.Join(args, " ")); err != nil {
+		return err
+	}
 
-	errStateC := make(chan error, 1)
-	worker.Go(func() {
-		errStateC <- proc.AddState(processor.State{
-			HostId:    0,
-			ProcessId: config.Program.Pid,
-			State:     "active",
-		})
+	ret := job.run(transport.Local(), "localhost", ffmpegofFfmpegCommand, transport.Stdio{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
 	})
-
-	runnableCommand := runCommand(ffmpegofFfmpegCommand, stdin, stdout, stderr)
-	return runnableCommand.Run(), <-errProcessC, <-errStateC
+	return ret
 }
 
-func runRemoteFfmpeg(config *config.Config, proc *processor.Processor, cmd string, args []string, target processor.Host) (error, error, error) {
-	ffmpegofSshCommand := generateSshCommand(config, target.Hostname)
+func runRemoteFfmpeg(config *config.Config, proc *processor.Processor, cmd string, args []string, target processor.Host, job *job) error {
+	remoteTransport, err := transport.New(target.Transport, config)
+	if err != nil {
+		return err
+	}
 	ffmpegofFfmpegCommand := make([]string, 0)
 
 	// Add any pre commands
 	ffmpegofFfmpegCommand = append(ffmpegofFfmpegCommand, config.Commands.Pre...)
 
 	// Prepare our default stdin/stdout/stderr
-	stdin := os.Stdin
-	stdout := os.Stdout
-	stderr := os.Stderr
+	stdin := job.stdin.reader
+	var stdout io.Writer = os.Stdout
+	stderr := job.stderr(os.Stderr)
 
-	if strings.Contains(cmd, "ffprobe") {
+	if strings.Contains(filepath.Base(cmd), "ffprobe") {
 		// If we're in ffprobe mode use that command and os.Stdout as stdout
 		ffmpegofFfmpegCommand = append(ffmpegofFfmpegCommand, config.Commands.Ffprobe)
 	} else {
@@ -397,86 +487,234 @@ func runRemoteFfmpeg(config *config.Config, proc *processor.Processor, cmd strin
 		}
 	}
 
-	ffmpegofFullCommand := append(ffmpegofSshCommand, shellescape.QuoteCommand(ffmpegofFfmpegCommand))
+	// Output written to pipe:1 has to reach the real stdout
+	if _, stdoutPipe := usesPipes(args); stdoutPipe {
+		stdout = os.Stdout
+	}
+
+	ffmpegofFullCommand := remoteTransport.Command(target.Hostname, ffmpegofFfmpegCommand)
 
-	log.Info().Str("host", target.Servername).Msg("running command")
+	log.Info().Str("host", target.Servername).Str("transport", remoteTransport.Name()).Msg("running command")
 	log.Debug().Str("command", strings.Join(ffmpegofFullCommand, " ")).Msg("remote")
 
-	var worker conc.WaitGroup
+	if err := recordActive(config, proc, target, cmd+" "+strings.Join(args, " ")); err != nil {
+		return err
+	}
 
-	errProcessC := make(chan error, 1)
-	fullCommand := cmd + " " + strings.Join(args, " ")
-	worker.Go(func() {
-		errProcessC <- proc.AddProcess(processor.Process{
-			HostId:    target.Id,
-			ProcessId: config.Program.Pid,
-			Cmd:       fullCommand,
-		})
+	ret := job.run(remoteTransport, target.Hostname, ffmpegofFfmpegCommand, transport.Stdio{
+		Stdin:  stdin,
+		Stdout: stdout,
+		Stderr: stderr,
 	})
+	return ret
+}
 
-	errStateC := make(chan error, 1)
-	worker.Go(func() {
-		errStateC <- proc.AddState(processor.State{
-			HostId:    target.Id,
-			ProcessId: config.Program.Pid,
-			State:     "active",
-		})
-	})
+// Run returns the exit code of ffmpeg, or ExitStalled if the watchdog killed it
+func Run(config *config.Config, proc *processor.Processor, cmd string, args []string) int {
+	started := time.Now()
+	job, err := newJob(config, cmd, args)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed setting up stdin")
+	}
 
-	runnableCommand := runCommand(ffmpegofFullCommand, stdin, stdout, stderr)
-	return runnableCommand.Run(), <-errProcessC, <-errStateC
-}
+	// handle interrupt signal, ffmpeg is stopped before anything is cleaned up
+	quitChannel := make(chan os.Signal, 1)
+	signal.Notify(quitChannel, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP, os.Interrupt)
 
-func Run(config *config.Config, proc *processor.Processor, cmd string, args []string) {
 	returnChannel := make(chan error, 1)
 	var worker conc.WaitGroup
 	worker.Go(func() {
 		log.Info().Str("as", cmd).Str("args", strings.Join(args[:], " ")).Msg("starting ffmpegof")
 
-		target, err := getTargetHost(config, proc)
+		// rows of killed wrappers would make their hosts look busy or bad forever
+		report, err := reaper.Prune(proc, config.Program.Instance)
+		if err != nil {
+			log.Warn().Err(err).Msg("failed pruning stale processes and states")
+		} else if len(report.Processes) > 0 || len(report.States) > 0 {
+			log.Info().
+				Int("processes", len(report.Processes)).
+				Int("states", len(report.States)).
+				Msg("pruned stale processes and states")
+		}
+
+		// with sync.startup the inventory of the config is reconciled before a host is picked from it
+		if config.Sync.Startup && len(config.Hosts) > 0 {
+			plan, err := inventory.Sync(config, proc, config.Sync.Mode, false)
+			if err != nil {
+				log.Warn().Err(err).Msg("failed syncing hosts")
+			} else if !plan.Empty() {
+				log.Info().
+					Int("added", len(plan.Add)).
+					Int("updated", len(plan.Update)).
+					Int("removed", len(plan.Remove)).
+					Msg("synced hosts")
+				degraded.Refresh(config, proc)
+			}
+		}
+
+		target, retries, err := getTargetHost(config, proc)
 		if err != nil {
 			log.Error().Err(err).Msg("failed getting target host")
+			returnChannel <- err
 		} else {
-			var ret, errProcess, errState error
-			if target.Hostname == "localhost" || target.Hostname == "127.0.0.1" || target.Hostname == "::1" {
-				ret, errProcess, errState = runLocalFfmpeg(config, proc, cmd, args)
-			} else {
-				ret, errProcess, errState = runRemoteFfmpeg(config, proc, cmd, args, target)
+			local := target.Fallback || target.Hostname == "localhost" || target.Hostname == "127.0.0.1" || target.Hostname == "::1"
+
+			// A pseudo-terminal would mangle piped binary data, so such jobs stay local
+			stdinPipe, stdoutPipe := usesPipes(args)
+			if !local && (stdinPipe || stdoutPipe) && transport.UsesTty(target.Transport, config) {
+				log.Warn().
+					Str("host", target.Servername).
+					Msg("command uses pipes which don't survive a pseudo-terminal, running on localhost")
+				local = true
+				if fallback, err := proc.GetFallbackHost(); err == nil {
+					target = fallback
+				} else {
+					log.Error().Err(err).Msg("failed getting fallback host")
+				}
 			}
+			job.setTarget(target, retries)
 
-			if errProcess != nil {
-				log.Error().Err(errProcess).Msg("failed adding process")
-			}
-			if errState != nil {
-				log.Error().Err(errState).Msg("failed adding state")
+			var ret error
+			if local {
+				ret = runLocalFfmpeg(config, proc, cmd, args, target, job)
+			} else {
+				ret = runRemoteFfmpeg(config, proc, cmd, args, target, job)
 			}
 			returnChannel <- ret
 		}
 	})
 
-	// handle interrupt signal
-	quitChannel := make(chan os.Signal, 1)
-	signal.Notify(quitChannel, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT, syscall.SIGHUP, os.Interrupt)
-	select {
-	case <-quitChannel:
-		{
-			log.Warn().Msg("forced quit executed")
-		}
-	case ret := <-returnChannel:
-		{
-			if ret != nil {
-				log.Error().Err(ret).Msg("finished ffmpegof with error")
+	reportDone := make(chan struct{})
+	go reportProgress(config, proc, job.status, reportDone)
+
+	var ret error
+	var killTimer <-chan time.Time
+	stopping := false
+	stalled := false
+	failure := ""
+	for done := false; !done; {
+		select {
+		case reason := <-job.watchdog.tripped:
+			log.Error().Str("reason", reason).Msg("watchdog killing ffmpeg")
+			stalled = true
+			job.kill()
+			markSuspect(config, proc, job.getTarget(), reason)
+			failure = reason
+		case sig := <-quitChannel:
+			if !stopping {
+				log.Warn().Str("signal", sig.String()).Msg("stopping ffmpeg")
+				stopping = true
+				job.stop(sig)
+				killTimer = time.After(time.Duration(config.Program.StopTimeout) * time.Second)
 			} else {
-				log.Info().Msg("finished ffmpegof successfully")
+				log.Warn().Str("signal", sig.String()).Msg("forced quit executed")
+				job.kill()
 			}
+		case <-killTimer:
+			log.Warn().Msg("ffmpeg didn't stop in time, killing it")
+			job.kill()
+		case ret = <-returnChannel:
+			done = true
 		}
 	}
 
-	errStates, errProcesses := cleanup(config.Program.Pid, proc)
+	close(reportDone)
+
+	if ret != nil {
+		log.Error().Err(ret).Msg("finished ffmpegof with error")
+	} else {
+		log.Info().Msg("finished ffmpegof successfully")
+	}
+
+	errStates, errProcesses := cleanup(config, proc)
 	if errStates != nil {
 		log.Error().Err(errStates).Msg("error occured during cleanup of states")
 	}
 	if errProcesses != nil {
 		log.Error().Err(errProcesses).Msg("error occured during cleanup of processes")
 	}
+
+	code := exitCode(ret, stalled)
+	status := "success"
+	switch {
+	case stalled:
+		status = "stalled"
+	case stopping:
+		status = "stopped"
+	case ret != nil:
+		status = "failed"
+	}
+	if failure == "" && ret != nil {
+		failure = ret.Error()
+	}
+	recordJob(config, proc, job, processor.Job{
+		ProcessId: config.Program.Pid,
+		Instance:  config.Program.Instance,
+		Class:     job.watchdog.class,
+		Cmd:       strings.Join(append([]string{cmd}, args...), " "),
+		Started:   started,
+		Status:    status,
+		ExitCode:  code,
+		Reason:    failure,
+	})
+
+	return code
+}
+
+// recordJob adds the finished job to the history and drops jobs older than the retention
+func recordJob(config *config.Config, proc *processor.Processor, job *job, record processor.Job) {
+	if config.History.Retention < 0 {
+		return
+	}
+
+	target := job.getTarget()
+	record.HostId = target.Id
+	record.Servername = target.Servername
+	record.Retries = job.retries
+	record.Ended = time.Now()
+	record.Overhead = record.Ended.Sub(record.Started) - job.runtime()
+
+	if err := proc.AddJob(record); err != nil {
+		log.Error().Err(err).Msg("failed recording job")
+	}
+	if config.History.Retention > 0 {
+		before := record.Ended.AddDate(0, 0, -config.History.Retention)
+		if err := proc.RemoveJobsBefore(before); err != nil {
+			log.Error().Err(err).Msg("failed removing old jobs")
+		}
+	}
+}
+
+// markSuspect flags a host whose job stalled, it is only used again once no other host is left.
+// The state isn't tied to this process, so it outlives the cleanup until the host is cleared.
+func markSuspect(config *config.Config, proc *processor.Processor, target processor.Host, reason string) {
+	if target.Id == 0 || target.Fallback {
+		return
+	}
+
+	log.Warn().Str("host", target.Servername).Str("reason", reason).Msg("marking as suspect")
+	err := proc.AddState(processor.State{
+		HostId:    target.Id,
+		ProcessId: 0,
+		State:     "suspect",
+		Instance:  config.Program.Instance,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("host", target.Servername).Msg("failed to mark host as suspect")
+	}
+}
+
+func exitCode(err error, stalled bool) int {
+	if stalled {
+		return ExitStalled
+	}
+	if err == nil {
+		return 0
+	}
+
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return exitErr.ExitCode()
+	}
+	return 1
 }
@@ -0,0 +1,174 @@
+package ffmpeg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tminaorg/ffmpegof/src/config"
+	"github.com/tminaorg/ffmpegof/src/processor"
+)
+
+// testHost describes a host of the memory store, its jobs and the states marking it
+type testHost struct {
+	servername string
+	hostname   string
+	transport  string
+	weight     int
+	processes  int
+	states     []string
+}
+
+// newTestProcessor adds the hosts to a memory store, localhost skips the transport test. Hosts
+// are looked at concurrently, so tests can't rely on their order.
+func newTestProcessor(t *testing.T, hosts []testHost) *processor.Processor {
+	t.Helper()
+	proc, err := processor.New(processor.Config{DbType: "memory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Now()
+	for i, host := range hosts {
+		hostname := host.hostname
+		if hostname == "" {
+			hostname = "localhost"
+		}
+		err := proc.AddHost(processor.Host{
+			Servername: host.servername,
+			Hostname:   hostname,
+			Weight:     host.weight,
+			Created:    created.Add(time.Duration(i) * time.Second),
+			Transport:  host.transport,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		added, err := proc.GetHostsByField("servername", host.servername)
+		if err != nil || len(added) != 1 {
+			t.Fatalf("get host %s: %v", host.servername, err)
+		}
+		for pid := 1; pid <= host.processes; pid++ {
+			if err := proc.AddProcess(processor.Process{HostId: added[0].Id, ProcessId: pid, Cmd: "ffmpeg"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, state := range host.states {
+			if err := proc.AddState(processor.State{HostId: added[0].Id, ProcessId: 1, State: state}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return proc
+}
+
+func TestGetTargetHost(t *testing.T) {
+	tests := []struct {
+		name    string
+		hosts   []testHost
+		want    string
+		retries int
+	}{
+		{
+			name:  "no hosts",
+			hosts: nil,
+			want:  "localhost (fallback)",
+		},
+		{
+			name: "idle",
+			hosts: []testHost{
+				{servername: "busy", weight: 1, processes: 1, states: []string{"active"}},
+				{servername: "idle", weight: 1},
+			},
+			want: "idle",
+		},
+		{
+			name: "bad",
+			hosts: []testHost{
+				{servername: "bad", weight: 1, states: []string{"bad"}},
+				{servername: "busy", weight: 1, processes: 3, states: []string{"active"}},
+			},
+			want: "busy",
+		},
+		{
+			name: "all bad",
+			hosts: []testHost{
+				{servername: "bad", weight: 1, states: []string{"bad"}},
+			},
+			want: "localhost (fallback)",
+		},
+		{
+			name: "failed health check",
+			hosts: []testHost{
+				{servername: "unreachable", hostname: "unreachable", transport: "docker", weight: 1},
+				{servername: "busy", weight: 1, processes: 1, states: []string{"active"}},
+			},
+			want:    "busy",
+			retries: 1,
+		},
+		{
+			name: "drained",
+			hosts: []testHost{
+				{servername: "drained", weight: 1, states: []string{"drained"}},
+				{servername: "busy", weight: 1, processes: 2, states: []string{"active"}},
+			},
+			want: "busy",
+		},
+		{
+			name: "all drained",
+			hosts: []testHost{
+				{servername: "drained", weight: 1, states: []string{"drained"}},
+			},
+			want: "localhost (fallback)",
+		},
+		{
+			name: "suspect",
+			hosts: []testHost{
+				{servername: "suspect", weight: 1, states: []string{"suspect"}},
+				{servername: "busy", weight: 1, processes: 4, states: []string{"active"}},
+			},
+			want: "busy",
+		},
+		{
+			name: "only suspects",
+			hosts: []testHost{
+				{servername: "bad", weight: 1, states: []string{"bad"}},
+				{servername: "loaded suspect", weight: 1, processes: 2, states: []string{"active", "suspect"}},
+				{servername: "suspect", weight: 1, processes: 1, states: []string{"active", "suspect"}},
+			},
+			want: "suspect",
+		},
+		{
+			name: "weighted",
+			hosts: []testHost{
+				{servername: "light", weight: 1, processes: 2, states: []string{"active"}},
+				{servername: "heavy", weight: 4, processes: 4, states: []string{"active"}},
+			},
+			want: "heavy",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the health check of remote hosts runs "false" instead of docker, so it always fails
+			conf := &config.Config{}
+			conf.Commands.Docker = "false"
+			conf.Commands.Ffmpeg = "ffmpeg"
+
+			proc := newTestProcessor(t, test.hosts)
+			target, retries, err := getTargetHost(conf, proc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if target.Servername != test.want {
+				t.Errorf("target: got %s, want %s", target.Servername, test.want)
+			}
+			if target.Fallback != (test.want == "localhost (fallback)") {
+				t.Errorf("fallback: got %t", target.Fallback)
+			}
+			if retries != test.retries {
+				t.Errorf("retries: got %d, want %d", retries, test.retries)
+			}
+		})
+	}
+}
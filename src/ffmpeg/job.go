@@ -0,0 +1,229 @@
+package ffmpeg
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tminaorg/ffmpegof/src/config"
+	"github.com/tminaorg/ffmpegof/src/processor"
+	"github.com/tminaorg/ffmpegof/src/transport"
+)
+
+var errStopped = errors.New("stopped before ffmpeg was started")
+
+// stdinForwarder relays the wrapper's stdin to ffmpeg through a pipe, so a "q" can be
+// injected when the wrapper itself is asked to stop
+type stdinForwarder struct {
+	reader *os.File
+
+	mu     sync.Mutex
+	writer *os.File
+}
+
+func newStdinForwarder(stdin io.Reader) (*stdinForwarder, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &stdinForwarder{reader: reader, writer: writer}
+	go f.copy(stdin)
+	return f, nil
+}
+
+// copy forwards every read immediately, so a "q" written by the media server isn't held back
+func (f *stdinForwarder) copy(stdin io.Reader) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := stdin.Read(buf)
+		if n > 0 {
+			f.mu.Lock()
+			if f.writer == nil {
+				f.mu.Unlock()
+				return
+			}
+			_, errWrite := f.writer.Write(buf[:n])
+			f.mu.Unlock()
+			if errWrite != nil {
+				return
+			}
+		}
+		if err != nil {
+			// ffmpeg reading from pipe:0 needs to see the end of its input
+			f.closeWriter()
+			return
+		}
+	}
+}
+
+// quit asks ffmpeg to finish its outputs, which is only possible while stdin is still open and
+// not stuck in a write ffmpeg doesn't read
+func (f *stdinForwarder) quit() bool {
+	if !f.mu.TryLock() {
+		return false
+	}
+	defer f.mu.Unlock()
+	if f.writer == nil {
+		return false
+	}
+	_, err := f.writer.Write([]byte("q"))
+	return err == nil
+}
+
+func (f *stdinForwarder) closeWriter() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.writer != nil {
+		f.writer.Close()
+		f.writer = nil
+	}
+}
+
+// close closes the reader first, which fails a write ffmpeg never read instead of waiting for it
+func (f *stdinForwarder) close() {
+	f.reader.Close()
+	f.closeWriter()
+}
+
+// job is the running ffmpeg, shared with the signal handler so it can be stopped gracefully
+type job struct {
+	stdin *stdinForwarder
+	// ffmpeg reading its input from stdin would take "q" as data
+	stdinPipe bool
+	watchdog  *watchdog
+	status    *statusWriter
+
+	mu      sync.Mutex
+	process transport.Process
+	stopped bool
+	target  processor.Host
+	retries int
+	started time.Time
+	ended   time.Time
+}
+
+func newJob(config *config.Config, cmd string, args []string) (*job, error) {
+	stdin, err := newStdinForwarder(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	stdinPipe, _ := usesPipes(args)
+	j := &job{stdin: stdin, stdinPipe: stdinPipe, watchdog: newWatchdog(config, cmd, args)}
+
+	// probes and info requests don't report progress
+	if j.watchdog.class != classProbe && j.watchdog.class != classInfo {
+		j.status = &statusWriter{watchdog: j.watchdog}
+	}
+	return j, nil
+}
+
+// stderr wraps the stderr of the job so its progress can be followed
+func (j *job) stderr(stderr io.Writer) io.Writer {
+	if j.status == nil {
+		return stderr
+	}
+	j.status.w = stderr
+	return j.status
+}
+
+// run starts the command unless the job was stopped already and waits for it to finish
+func (j *job) run(t transport.Transport, target string, command []string, stdio transport.Stdio) error {
+	defer j.stdin.close()
+
+	j.mu.Lock()
+	stopped := j.stopped
+	j.mu.Unlock()
+	if stopped {
+		return errStopped
+	}
+
+	// starting can take a while, like the dial of the worker transport, a stop doesn't wait for it
+	process, err := t.Start(target, command, stdio)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	if j.stopped {
+		j.mu.Unlock()
+		if err := process.Signal(os.Kill); err != nil {
+			log.Warn().Err(err).Msg("failed killing ffmpeg")
+		}
+		process.Wait()
+		return errStopped
+	}
+	j.process = process
+	j.started = time.Now()
+	j.mu.Unlock()
+
+	j.watchdog.start()
+	defer j.watchdog.stop()
+	err = process.Wait()
+
+	j.mu.Lock()
+	j.ended = time.Now()
+	j.mu.Unlock()
+	return err
+}
+
+// setTarget records the host the job runs on and how many hosts failed their health check before
+func (j *job) setTarget(target processor.Host, retries int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.target = target
+	j.retries = retries
+}
+
+func (j *job) getTarget() processor.Host {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.target
+}
+
+// runtime is how long ffmpeg itself ran, the rest of the wrapper's runtime is overhead
+func (j *job) runtime() time.Duration {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.started.IsZero() || j.ended.IsZero() {
+		return 0
+	}
+	return j.ended.Sub(j.started)
+}
+
+// stop asks ffmpeg to quit through stdin, or forwards the signal if that isn't possible
+func (j *job) stop(sig os.Signal) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.stopped = true
+	if j.process == nil {
+		return
+	}
+
+	if !j.stdinPipe && j.stdin.quit() {
+		log.Debug().Msg("sent quit to ffmpeg")
+		return
+	}
+	if err := j.process.Signal(sig); err != nil {
+		log.Warn().Err(err).Str("signal", sig.String()).Msg("failed forwarding signal")
+	}
+}
+
+// kill reaches ffmpeg itself with the worker transport, the other transports only kill their
+// local client, which leaves a remote ffmpeg running until it writes to its closed output
+func (j *job) kill() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.stopped = true
+	if j.process == nil {
+		return
+	}
+
+	if err := j.process.Signal(os.Kill); err != nil {
+		log.Warn().Err(err).Msg("failed killing ffmpeg")
+	}
+}
@@ -0,0 +1,76 @@
+package ffmpeg
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/tminaorg/ffmpegof/src/config"
+	"github.com/tminaorg/ffmpegof/src/transport"
+)
+
+type fakeProcess struct {
+	signals []os.Signal
+	waited  bool
+}
+
+func (p *fakeProcess) Wait() error {
+	p.waited = true
+	return nil
+}
+
+func (p *fakeProcess) Signal(sig os.Signal) error {
+	p.signals = append(p.signals, sig)
+	return nil
+}
+
+// fakeTransport runs starting before it returns the process, like a stop arriving during a dial
+type fakeTransport struct {
+	process  *fakeProcess
+	starting func()
+}
+
+func (t *fakeTransport) Name() string {
+	return "fake"
+}
+
+func (t *fakeTransport) Command(target string, command []string) []string {
+	return command
+}
+
+func (t *fakeTransport) Start(target string, command []string, stdio transport.Stdio) (transport.Process, error) {
+	t.starting()
+	return t.process, nil
+}
+
+func TestJobStoppedWhileStarting(t *testing.T) {
+	tests := []struct {
+		name string
+		stop func(j *job)
+	}{
+		{"stop", func(j *job) { j.stop(os.Interrupt) }},
+		{"kill", func(j *job) { j.kill() }},
+	}
+
+	for _, test := range tests {
+		stdin, err := newStdinForwarder(strings.NewReader(""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		j := &job{stdin: stdin, watchdog: newWatchdog(&config.Config{}, "ffmpeg", []string{"-i", "in.mkv", "out.mkv"})}
+
+		// the stop would block on the lock if the job held it while starting
+		process := &fakeProcess{}
+		err = j.run(&fakeTransport{process: process, starting: func() { test.stop(j) }}, "host", []string{"ffmpeg"}, transport.Stdio{})
+		if !errors.Is(err, errStopped) {
+			t.Errorf("%s: got %v, want %v", test.name, err, errStopped)
+		}
+		if len(process.signals) != 1 || process.signals[0] != os.Kill || !process.waited {
+			t.Errorf("%s: process got signals %v and waited %t, want killed and waited", test.name, process.signals, process.waited)
+		}
+		if j.process != nil {
+			t.Errorf("%s: stopped job kept its process", test.name)
+		}
+	}
+}
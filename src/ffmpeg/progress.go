@@ -0,0 +1,138 @@
+package ffmpeg
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tminaorg/ffmpegof/src/config"
+	"github.com/tminaorg/ffmpegof/src/processor"
+)
+
+// matches the "key=value" pairs of a status line, ffmpeg pads some values with spaces
+var progressField = regexp.MustCompile(`(\w+)=\s*(\S+)`)
+
+// progress is the last status line reported by ffmpeg
+type progress struct {
+	Frame   int
+	Fps     float64
+	Speed   float64
+	OutTime string
+	Bitrate string
+}
+
+// parseProgress parses a status line like
+// "frame=  120 fps= 30 q=28.0 size=  256kB time=00:00:04.00 bitrate= 524.3kbits/s speed=1.02x"
+func parseProgress(line string) (progress, bool) {
+	p := progress{}
+	found := false
+	for _, match := range progressField.FindAllStringSubmatch(line, -1) {
+		value := match[2]
+		switch match[1] {
+		case "frame":
+			p.Frame, _ = strconv.Atoi(value)
+			found = true
+		case "fps":
+			p.Fps, _ = strconv.ParseFloat(value, 64)
+		case "speed":
+			p.Speed, _ = strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+		case "time", "out_time":
+			p.OutTime = value
+			found = true
+		case "bitrate":
+			p.Bitrate = value
+		}
+	}
+	return p, found
+}
+
+// statusWriter relays ffmpeg's output while following the status lines in it. It is shared by
+// stdout and stderr, which are written concurrently.
+type statusWriter struct {
+	w        io.Writer
+	watchdog *watchdog
+
+	mu      sync.Mutex
+	partial []byte
+	latest  progress
+	changed bool
+}
+
+func (s *statusWriter) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, err := s.w.Write(b)
+
+	// status lines end with "\r" so they overwrite each other on a terminal
+	data := append(s.partial, b[:n]...)
+	for {
+		index := bytes.IndexAny(data, "\r\n")
+		if index < 0 {
+			break
+		}
+		if p, ok := parseProgress(string(data[:index])); ok {
+			if p != s.latest {
+				s.latest = p
+				s.changed = true
+			}
+			s.watchdog.advance(p)
+		}
+		data = data[index+1:]
+	}
+
+	// status lines are short, anything longer isn't one
+	if len(data) > 4096 {
+		data = data[:0]
+	}
+	s.partial = append(s.partial[:0], data...)
+	return n, err
+}
+
+// take returns the latest progress if it changed since the last call
+func (s *statusWriter) take() (progress, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := s.changed
+	s.changed = false
+	return s.latest, changed
+}
+
+// reportProgress records the progress of the job on its process row every interval until done is closed
+func reportProgress(config *config.Config, proc *processor.Processor, status *statusWriter, done chan struct{}) {
+	if status == nil || config.Program.ProgressInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(config.Program.ProgressInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			p, changed := status.take()
+			if !changed {
+				continue
+			}
+			err := proc.UpdateProcessProgress(processor.Process{
+				ProcessId: config.Program.Pid,
+				Instance:  config.Program.Instance,
+				Frame:     p.Frame,
+				Fps:       p.Fps,
+				Speed:     p.Speed,
+				OutTime:   p.OutTime,
+				Bitrate:   p.Bitrate,
+				Updated:   now,
+			})
+			if err != nil {
+				log.Warn().Err(err).Msg("failed recording progress")
+			}
+		}
+	}
+}
@@ -5,7 +5,10 @@ type HostMapping struct {
 	Servername   string
 	Hostname     string
 	Weight       int
+	Transport    string
 	CurrentState string
 	MarkingPid   string
+	Suspect      bool
+	Drained      bool
 	Commands     []int
 }
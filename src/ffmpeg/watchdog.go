@@ -0,0 +1,160 @@
+package ffmpeg
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tminaorg/ffmpegof/src/config"
+)
+
+// ExitStalled is returned when the watchdog killed a job, so it can be told apart from ffmpeg failing
+const ExitStalled = 124
+
+// Job classes, each with its own maximum runtime
+const (
+	classProbe     = "probe"
+	classInfo      = "info"
+	classImage     = "image"
+	classHls       = "hls"
+	classTranscode = "transcode"
+)
+
+// jobClass guesses what kind of job the arguments describe
+func jobClass(cmd string, args []string) string {
+	if strings.Contains(filepath.Base(cmd), "ffprobe") {
+		return classProbe
+	}
+	if !sliceContains(args, "-i") {
+		return classInfo
+	}
+
+	for index, arg := range args {
+		next := ""
+		if index+1 < len(args) {
+			next = args[index+1]
+		}
+		switch {
+		case arg == "-f" && next == "hls", strings.HasSuffix(arg, ".m3u8") && index == len(args)-1:
+			return classHls
+		case (arg == "-frames:v" || arg == "-vframes") && next == "1", arg == "-f" && next == "image2":
+			return classImage
+		}
+	}
+	return classTranscode
+}
+
+// Class guesses the kind of job of a command line as recorded with its process
+func Class(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return classInfo
+	}
+	return jobClass(fields[0], fields[1:])
+}
+
+func maxRuntime(config *config.Config, class string) time.Duration {
+	seconds := 0
+	switch class {
+	case classProbe:
+		seconds = config.Watchdog.Runtime.Probe
+	case classInfo:
+		seconds = config.Watchdog.Runtime.Info
+	case classImage:
+		seconds = config.Watchdog.Runtime.Image
+	case classHls:
+		seconds = config.Watchdog.Runtime.Hls
+	case classTranscode:
+		seconds = config.Watchdog.Runtime.Transcode
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// watchdog kills jobs whose progress stops advancing or that run longer than their class allows
+type watchdog struct {
+	class      string
+	stall      time.Duration
+	maxRuntime time.Duration
+	tripped    chan string
+	done       chan struct{}
+
+	mu         sync.Mutex
+	started    time.Time
+	progressed time.Time
+	last       string
+}
+
+func newWatchdog(config *config.Config, cmd string, args []string) *watchdog {
+	w := &watchdog{
+		class:   jobClass(cmd, args),
+		stall:   time.Duration(config.Watchdog.Stall) * time.Second,
+		tripped: make(chan string, 1),
+		done:    make(chan struct{}),
+	}
+	w.maxRuntime = maxRuntime(config, w.class)
+
+	// probes and info requests don't report progress
+	if w.class == classProbe || w.class == classInfo {
+		w.stall = 0
+	}
+	return w
+}
+
+func (w *watchdog) enabled() bool {
+	return w.stall > 0 || w.maxRuntime > 0
+}
+
+func (w *watchdog) start() {
+	if !w.enabled() {
+		return
+	}
+
+	w.mu.Lock()
+	w.started = time.Now()
+	w.progressed = w.started
+	w.mu.Unlock()
+
+	go w.run()
+}
+
+func (w *watchdog) stop() {
+	close(w.done)
+}
+
+func (w *watchdog) run() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case now := <-ticker.C:
+			w.mu.Lock()
+			started, progressed := w.started, w.progressed
+			w.mu.Unlock()
+
+			if w.maxRuntime > 0 && now.Sub(started) > w.maxRuntime {
+				w.tripped <- fmt.Sprintf("%s job exceeded its maximum runtime of %s", w.class, w.maxRuntime)
+				return
+			}
+			if w.stall > 0 && now.Sub(progressed) > w.stall {
+				w.tripped <- fmt.Sprintf("no progress for %s", w.stall)
+				return
+			}
+		}
+	}
+}
+
+// advance resets the stall window if the frame or time of the job moved on
+func (w *watchdog) advance(p progress) {
+	current := fmt.Sprintf("%d %s", p.Frame, p.OutTime)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if current != w.last {
+		w.last = current
+		w.progressed = time.Now()
+	}
+}
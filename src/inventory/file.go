@@ -0,0 +1,88 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/tminaorg/ffmpegof/src/config"
+	"github.com/tminaorg/ffmpegof/src/processor"
+)
+
+// Entry is a host as exported, the same as in the hosts section of the config
+type Entry struct {
+	Name      string `yaml:"name" json:"name"`
+	Hostname  string `yaml:"hostname" json:"hostname"`
+	Weight    int    `yaml:"weight" json:"weight"`
+	Transport string `yaml:"transport" json:"transport"`
+}
+
+// File is an exported inventory, which can be pasted into the config as is
+type File struct {
+	Hosts []Entry `yaml:"hosts" json:"hosts"`
+}
+
+// Export writes the hosts in the database as YAML or JSON
+func Export(proc *processor.Processor, w io.Writer, format string) error {
+	hosts, err := proc.GetHosts()
+	if err != nil {
+		return err
+	}
+
+	file := File{Hosts: make([]Entry, 0, len(hosts))}
+	for _, host := range hosts {
+		file.Hosts = append(file.Hosts, Entry{
+			Name:      host.Servername,
+			Hostname:  host.Hostname,
+			Weight:    host.Weight,
+			Transport: host.Transport,
+		})
+	}
+
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(file)
+	case "yaml":
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(file); err != nil {
+			return err
+		}
+		return encoder.Close()
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// Read parses an exported inventory, JSON being valid YAML. Unknown fields are refused, as
+// they are most likely misspelled settings.
+func Read(r io.Reader) ([]config.Host, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	file := File{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+
+	entries := make([]config.Host, 0, len(file.Hosts))
+	for _, entry := range file.Hosts {
+		entries = append(entries, config.Host{
+			Name:      entry.Name,
+			Hostname:  entry.Hostname,
+			Weight:    entry.Weight,
+			Transport: entry.Transport,
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,169 @@
+package inventory
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/tminaorg/ffmpegof/src/config"
+	"github.com/tminaorg/ffmpegof/src/processor"
+	"github.com/tminaorg/ffmpegof/src/transport"
+)
+
+// Modes of a sync, authoritative removes the hosts missing from the inventory
+const (
+	Merge         = "merge"
+	Authoritative = "authoritative"
+)
+
+// Update is a host whose hostname, weight or transport changes
+type Update struct {
+	From processor.Host
+	To   processor.Host
+}
+
+// Plan lists the changes turning the hosts in the database into the inventory
+type Plan struct {
+	Add    []processor.Host
+	Update []Update
+	Remove []processor.Host
+}
+
+func (plan Plan) Empty() bool {
+	return len(plan.Add) == 0 && len(plan.Update) == 0 && len(plan.Remove) == 0
+}
+
+// Hosts validates the inventory and fills in the same defaults as "ffmpegof add"
+func Hosts(entries []config.Host, fallback processor.Host) ([]processor.Host, error) {
+	hosts := make([]processor.Host, 0, len(entries))
+	names := make(map[string]bool, len(entries))
+	for index, entry := range entries {
+		if entry.Hostname == "" {
+			return nil, fmt.Errorf("host %d: hostname is required", index+1)
+		}
+		if entry.Name == "" {
+			entry.Name = entry.Hostname
+		}
+		if entry.Name == fallback.Servername {
+			return nil, fmt.Errorf("host %s: name is reserved for the local fallback", entry.Name)
+		}
+		if names[entry.Name] {
+			return nil, fmt.Errorf("host %s: listed more than once", entry.Name)
+		}
+		names[entry.Name] = true
+
+		if entry.Weight == 0 {
+			entry.Weight = 1
+		}
+		if entry.Weight < 0 {
+			return nil, fmt.Errorf("host %s: weight can't be negative", entry.Name)
+		}
+		if entry.Transport == "" {
+			entry.Transport = transport.Ssh
+		}
+		if !slices.Contains(transport.Names, entry.Transport) {
+			return nil, fmt.Errorf("host %s: unsupported transport: %s", entry.Name, entry.Transport)
+		}
+
+		hosts = append(hosts, processor.Host{
+			Servername: entry.Name,
+			Hostname:   entry.Hostname,
+			Weight:     entry.Weight,
+			Transport:  entry.Transport,
+		})
+	}
+	return hosts, nil
+}
+
+// Diff plans the changes turning current into wanted
+func Diff(current []processor.Host, wanted []processor.Host, mode string) Plan {
+	plan := Plan{}
+	existing := make(map[string]processor.Host, len(current))
+	for _, host := range current {
+		existing[host.Servername] = host
+	}
+
+	listed := make(map[string]bool, len(wanted))
+	for _, host := range wanted {
+		listed[host.Servername] = true
+		from, ok := existing[host.Servername]
+		switch {
+		case !ok:
+			plan.Add = append(plan.Add, host)
+		case from.Hostname != host.Hostname || from.Weight != host.Weight || from.Transport != host.Transport:
+			// the creation time orders the hosts during selection, so it's kept
+			host.Id = from.Id
+			host.Created = from.Created
+			plan.Update = append(plan.Update, Update{From: from, To: host})
+		}
+	}
+
+	if mode == Authoritative {
+		for _, host := range current {
+			if !listed[host.Servername] {
+				plan.Remove = append(plan.Remove, host)
+			}
+		}
+	}
+	return plan
+}
+
+// Apply makes the changes of the plan in one transaction
+func Apply(proc *processor.Processor, plan Plan) error {
+	return proc.Transaction(func(proc *processor.Processor) error {
+		for _, host := range plan.Remove {
+			if err := proc.RemoveHost(host); err != nil {
+				return fmt.Errorf("remove %s: %w", host.Servername, err)
+			}
+		}
+		for _, update := range plan.Update {
+			if err := proc.AddHost(update.To); err != nil {
+				return fmt.Errorf("update %s: %w", update.To.Servername, err)
+			}
+		}
+
+		// hosts are selected in the order they were created, which keeps the order they're listed in
+		created := time.Now().Add(-time.Duration(len(plan.Add)) * time.Second)
+		for index, host := range plan.Add {
+			host.Created = created.Add(time.Duration(index) * time.Second)
+			if err := proc.AddHost(host); err != nil {
+				return fmt.Errorf("add %s: %w", host.Servername, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Sync plans the changes turning the hosts in the database into the inventory of the config
+// and applies them unless it's a dry run
+func Sync(config *config.Config, proc *processor.Processor, mode string, dryRun bool) (Plan, error) {
+	return Reconcile(proc, config.Hosts, mode, dryRun)
+}
+
+// Reconcile plans the changes turning the hosts in the database into the entries and applies
+// them unless it's a dry run
+func Reconcile(proc *processor.Processor, entries []config.Host, mode string, dryRun bool) (Plan, error) {
+	fallback, err := proc.GetFallbackHost()
+	if err != nil {
+		return Plan{}, err
+	}
+	wanted, err := Hosts(entries, fallback)
+	if err != nil {
+		return Plan{}, err
+	}
+	// an empty inventory is most likely a missing one
+	if len(wanted) == 0 && mode == Authoritative {
+		return Plan{}, fmt.Errorf("the inventory is empty, an authoritative sync would remove every host")
+	}
+
+	current, err := proc.GetHosts()
+	if err != nil {
+		return Plan{}, err
+	}
+
+	plan := Diff(current, wanted, mode)
+	if dryRun || plan.Empty() {
+		return plan, nil
+	}
+	return plan, Apply(proc, plan)
+}
@@ -0,0 +1,108 @@
+package inventory
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tminaorg/ffmpegof/src/config"
+	"github.com/tminaorg/ffmpegof/src/processor"
+)
+
+func TestHosts(t *testing.T) {
+	fallback := processor.Host{Servername: "localhost", Hostname: "localhost", Fallback: true}
+
+	tests := []struct {
+		name    string
+		entries []config.Host
+		want    []processor.Host
+		fails   bool
+	}{
+		{"empty", []config.Host{}, []processor.Host{}, false},
+		{
+			"defaults",
+			[]config.Host{{Hostname: "10.0.0.5"}},
+			[]processor.Host{{Servername: "10.0.0.5", Hostname: "10.0.0.5", Weight: 1, Transport: "ssh"}},
+			false,
+		},
+		{
+			"listed order",
+			[]config.Host{{Name: "gpu1", Hostname: "10.0.0.5", Weight: 2, Transport: "worker"}, {Hostname: "worker-b"}},
+			[]processor.Host{
+				{Servername: "gpu1", Hostname: "10.0.0.5", Weight: 2, Transport: "worker"},
+				{Servername: "worker-b", Hostname: "worker-b", Weight: 1, Transport: "ssh"},
+			},
+			false,
+		},
+		{"missing hostname", []config.Host{{Name: "gpu1"}}, nil, true},
+		{"fallback name", []config.Host{{Hostname: "localhost"}}, nil, true},
+		{"duplicate name", []config.Host{{Name: "gpu1", Hostname: "a"}, {Name: "gpu1", Hostname: "b"}}, nil, true},
+		{"duplicate default name", []config.Host{{Hostname: "gpu1"}, {Name: "gpu1", Hostname: "b"}}, nil, true},
+		{"negative weight", []config.Host{{Hostname: "gpu1", Weight: -1}}, nil, true},
+		{"unsupported transport", []config.Host{{Hostname: "gpu1", Transport: "telnet"}}, nil, true},
+	}
+
+	for _, test := range tests {
+		got, err := Hosts(test.entries, fallback)
+		if (err != nil) != test.fails {
+			t.Errorf("%s: got error %v, want error %t", test.name, err, test.fails)
+			continue
+		}
+		if !test.fails && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := processor.Host{Id: 1, Servername: "a", Hostname: "10.0.0.1", Weight: 1, Transport: "ssh", Created: created}
+	b := processor.Host{Id: 2, Servername: "b", Hostname: "10.0.0.2", Weight: 1, Transport: "ssh", Created: created}
+
+	listed := func(host processor.Host) processor.Host {
+		return processor.Host{Servername: host.Servername, Hostname: host.Hostname, Weight: host.Weight, Transport: host.Transport}
+	}
+	moved := listed(a)
+	moved.Hostname = "10.0.0.9"
+	heavier := listed(a)
+	heavier.Weight = 3
+	c := processor.Host{Servername: "c", Hostname: "10.0.0.3", Weight: 1, Transport: "worker"}
+
+	kept := func(from processor.Host, to processor.Host) Update {
+		to.Id = from.Id
+		to.Created = from.Created
+		return Update{From: from, To: to}
+	}
+
+	tests := []struct {
+		name    string
+		current []processor.Host
+		wanted  []processor.Host
+		mode    string
+		want    Plan
+	}{
+		{"unchanged", []processor.Host{a, b}, []processor.Host{listed(a), listed(b)}, Merge, Plan{}},
+		{"add", []processor.Host{a}, []processor.Host{listed(a), c}, Merge, Plan{Add: []processor.Host{c}}},
+		{"hostname", []processor.Host{a}, []processor.Host{moved}, Merge, Plan{Update: []Update{kept(a, moved)}}},
+		{"weight", []processor.Host{a}, []processor.Host{heavier}, Merge, Plan{Update: []Update{kept(a, heavier)}}},
+		{"merge keeps unlisted", []processor.Host{a, b}, []processor.Host{listed(a)}, Merge, Plan{}},
+		{"authoritative removes unlisted", []processor.Host{a, b}, []processor.Host{listed(a)}, Authoritative, Plan{Remove: []processor.Host{b}}},
+		{
+			"everything",
+			[]processor.Host{a, b},
+			[]processor.Host{moved, c},
+			Authoritative,
+			Plan{Add: []processor.Host{c}, Update: []Update{kept(a, moved)}, Remove: []processor.Host{b}},
+		},
+	}
+
+	for _, test := range tests {
+		got := Diff(test.current, test.wanted, test.mode)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %+v, want %+v", test.name, got, test.want)
+		}
+		if got.Empty() != test.want.Empty() {
+			t.Errorf("%s: empty got %t", test.name, got.Empty())
+		}
+	}
+}
@@ -2,67 +2,134 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/tminaorg/ffmpegof/src/config"
 	"github.com/tminaorg/ffmpegof/src/control"
+	"github.com/tminaorg/ffmpegof/src/degraded"
 	"github.com/tminaorg/ffmpegof/src/ffmpeg"
 	"github.com/tminaorg/ffmpegof/src/logger"
 	"github.com/tminaorg/ffmpegof/src/migrate"
 	"github.com/tminaorg/ffmpegof/src/processor"
+	"github.com/tminaorg/ffmpegof/src/reaper"
 )
 
-func main() {
-	// load config
-	c := config.New()
-	if err := c.Load("/etc/ffmpegof"); err != nil {
-		panic(fmt.Errorf("cannot load config: %s", err.Error()))
-	}
+// set by goreleaser
+var Version = "dev"
 
-	// setup logger
-	logger.Setup(c.Program.Log, c.Program.Debug)
+// setupMigrator opens the database, the schema is only managed by "ffmpegof db"
+func setupMigrator(database config.Database) (*sql.DB, *migrate.Migrator, error) {
+	if database.Type == "memory" {
+		return nil, nil, fmt.Errorf("the memory database has no schema")
+	}
 
 	// setup datastore
-	db, err := sql.Open(c.Database.Type, c.Database.Path)
+	db, err := sql.Open(database.Type, database.Path)
 	if err != nil {
-		log.Fatal().Err(err).Msg("failed opening datastore")
+		return nil, nil, fmt.Errorf("failed opening datastore: %w", err)
 	}
 
 	// setup migrator
-	mg, err := migrate.New(db, c.Database.Type, c.Database.MigratorDir)
+	mg, err := migrate.New(db, database.Type, database.MigratorDir)
 	if err != nil {
-		log.Fatal().Err(err).Msg("failed initialising migrator")
+		return nil, nil, fmt.Errorf("failed initialising migrator: %w", err)
+	}
+
+	return db, mg, nil
+}
+
+func setupProcessor(database config.Database) (*processor.Processor, error) {
+	if database.Type == "memory" {
+		return processor.New(processor.Config{DbType: database.Type})
+	}
+
+	db, mg, err := setupMigrator(database)
+	if err != nil {
+		return nil, err
 	}
 
 	// setup processor
 	proc, err := processor.New(processor.Config{
 		Db:     db,
-		DbType: c.Database.Type,
+		DbType: database.Type,
 		Mg:     mg,
+		Retry: processor.Retry{
+			Attempts:   database.Retries + 1,
+			Backoff:    time.Duration(database.Backoff) * time.Millisecond,
+			MaxBackoff: time.Duration(database.MaxBackoff) * time.Millisecond,
+		},
 	})
 	if err != nil {
-		log.Fatal().Err(err).Msg("failed initialising processor")
+		return nil, fmt.Errorf("failed initialising processor: %w", err)
 	}
 
 	// check database connection
 	databaseVersion, err := proc.GetVersion()
 	if err != nil {
-		log.Fatal().Err(err).Msg("failed getting database version")
+		return nil, fmt.Errorf("failed getting database version: %w", err)
 	} else {
 		log.Info().Msg(fmt.Sprintf("database in use: %s", databaseVersion))
 	}
 
+	return proc, nil
+}
+
+func main() {
+	// load config
+	c := config.New()
+	if err := c.Load("/etc/ffmpegof"); err != nil {
+		panic(fmt.Errorf("cannot load config: %s", err.Error()))
+	}
+	c.Program.Version = Version
+	c.Program.BootId, c.Program.PidStart = reaper.Self(c.Program.Pid)
+	if c.Program.Instance == "" {
+		c.Program.Instance = reaper.Instance(c.Program.BootId)
+	}
+
+	// setup logger
+	logger.Setup(c.Program.Log, c.Program.Debug)
+
 	// ffmpegof startup
 	cmd := os.Args[0]
 	args := os.Args[1:]
-	if strings.Contains(cmd, "ffmpegof") {
-		control.Run(proc)
-	} else if strings.Contains(cmd, "ffmpeg") || strings.Contains(cmd, "ffprobe") {
-		ffmpeg.Run(c, proc, cmd, args)
+	// only the name decides, the directories of the path could contain any of them
+	name := filepath.Base(cmd)
+	if strings.Contains(name, "ffmpegof") {
+		control.Run(c, setupProcessor, func(database config.Database) (*migrate.Migrator, error) {
+			_, mg, err := setupMigrator(database)
+			return mg, err
+		})
+	} else if strings.Contains(name, "rffmpeg") {
+		// checked before ffmpeg, which its name contains
+		control.RunRffmpeg(c, setupProcessor, func(database config.Database) (*migrate.Migrator, error) {
+			_, mg, err := setupMigrator(database)
+			return mg, err
+		})
+	} else if strings.Contains(name, "ffmpeg") || strings.Contains(name, "ffprobe") {
+		proc, err := setupProcessor(c.Database)
+		// a schema of another release needs an operator, running degraded would only hide it
+		if err != nil && (!c.Degraded.Enabled || errors.Is(err, migrate.ErrPending) || errors.Is(err, migrate.ErrNewer)) {
+			log.Fatal().Err(err).Msg("failed setting up datastore")
+		}
+		if err != nil {
+			// the job still runs, it's only recorded once the datastore is back
+			proc, err = degraded.Processor(c, err)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed setting up degraded mode")
+			}
+			code := ffmpeg.Run(c, proc, cmd, args)
+			degraded.Journal(c, proc)
+			os.Exit(code)
+		}
+		degraded.Recover(c, proc)
+		os.Exit(ffmpeg.Run(c, proc, cmd, args))
 	} else {
-		log.Fatal().Msg("entrypoint command must be one of three: [ffmpegof, ffmpeg, ffprobe]")
+		log.Fatal().Msg("entrypoint command must be one of four: [ffmpegof, rffmpeg, ffmpeg, ffprobe]")
 	}
 }
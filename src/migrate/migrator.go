@@ -4,14 +4,31 @@ import (
 	"embed"
 	"errors"
 	"fmt"
+	"sort"
 
 	"database/sql"
+	"github.com/go-sql-driver/mysql"
 	"github.com/lib/pq"
 	"modernc.org/sqlite"
 
 	"github.com/oriser/regroup"
 )
 
+// Errors returned by Check when the database schema doesn't match the migrations
+var (
+	ErrPending = errors.New("database schema is outdated")
+	ErrNewer   = errors.New("database schema is newer than this release")
+)
+
+// Status of a migration, Unknown ones were applied by a newer release
+type Status struct {
+	Version    int
+	Name       string
+	Applied    bool
+	Reversible bool
+	Unknown    bool
+}
+
 type Migrator struct {
 	db     *sql.DB
 	dbType string
@@ -32,21 +49,21 @@ func New(db *sql.DB, dbType string, dir string) (*Migrator, error) {
 	}
 
 	// validate supported driver
-	if dbType == "postgres" {
+	switch dbType {
+	case "postgres":
 		if _, ok := db.Driver().(*pq.Driver); !ok {
 			return nil, errors.New("database instance is not using the postgres driver")
 		}
-	} else {
+	case "mysql":
+		if _, ok := db.Driver().(*mysql.MySQLDriver); !ok {
+			return nil, errors.New("database instance is not using the mysql driver")
+		}
+	default:
 		if _, ok := db.Driver().(*sqlite.Driver); !ok {
 			return nil, errors.New("database instance is not using the sqlite driver")
 		}
 	}
 
-	// verify schema
-	if err = m.verify(); err != nil {
-		return nil, fmt.Errorf("verify: %w", err)
-	}
-
 	// compile migration regexp
 	m.re, err = regroup.Compile(`(?P<Version>\d+)\w?(?P<Name>.+)?\.sql`)
 	if err != nil {
@@ -57,6 +74,11 @@ func New(db *sql.DB, dbType string, dir string) (*Migrator, error) {
 }
 
 func (m *Migrator) Migrate(fs *embed.FS, component string) error {
+	// verify schema
+	if err := m.verify(); err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+
 	// parse migrations
 	migrations, err := m.parse(fs)
 	if err != nil {
@@ -81,10 +103,144 @@ func (m *Migrator) Migrate(fs *embed.FS, component string) error {
 		}
 
 		// migrate
-		if err := m.exec(component, m.dbType, mg); err != nil {
+		if err := m.exec(component, m.dbType, mg, false); err != nil {
 			return fmt.Errorf("migrate: %v: %w", mg.Filename, err)
 		}
 	}
 
 	return nil
 }
+
+// Status lists the migrations found in the filesystem and whether they were applied
+func (m *Migrator) Status(fs *embed.FS, component string) ([]Status, error) {
+	// verify schema
+	if err := m.verify(); err != nil {
+		return nil, fmt.Errorf("verify: %w", err)
+	}
+
+	// parse migrations
+	migrations, err := m.parse(fs)
+	if err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+
+	// get current migration versions
+	versions, err := m.versions(component, m.dbType)
+	if err != nil {
+		return nil, fmt.Errorf("versions: %v: %w", component, err)
+	}
+
+	statuses := make([]Status, 0, len(migrations))
+	for _, mg := range migrations {
+		statuses = append(statuses, Status{
+			Version:    mg.Version,
+			Name:       mg.Name,
+			Applied:    versions[mg.Version],
+			Reversible: mg.Down != "",
+		})
+		delete(versions, mg.Version)
+	}
+
+	// versions applied by a newer release
+	for version := range versions {
+		statuses = append(statuses, Status{
+			Version: version,
+			Applied: true,
+			Unknown: true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+// Rollback reverts the applied migrations newer than the version, newest first
+func (m *Migrator) Rollback(fs *embed.FS, component string, version int) error {
+	// verify schema
+	if err := m.verify(); err != nil {
+		return fmt.Errorf("verify: %w", err)
+	}
+
+	// parse migrations
+	migrations, err := m.parse(fs)
+	if err != nil {
+		return fmt.Errorf("parse: %w", err)
+	}
+
+	// get current migration versions
+	versions, err := m.versions(component, m.dbType)
+	if err != nil {
+		return fmt.Errorf("versions: %v: %w", component, err)
+	}
+
+	// check every migration can be reverted before touching any
+	known := make(map[int]bool, len(migrations))
+	for _, mg := range migrations {
+		known[mg.Version] = true
+		if mg.Version > version && versions[mg.Version] && mg.Down == "" {
+			return fmt.Errorf("rollback: %v: no down migration", mg.Filename)
+		}
+	}
+	for applied := range versions {
+		if applied > version && !known[applied] {
+			return fmt.Errorf("rollback: version %d is unknown to this release", applied)
+		}
+	}
+
+	// roll back
+	for index := len(migrations) - 1; index >= 0; index-- {
+		mg := migrations[index]
+		if mg.Version <= version || !versions[mg.Version] {
+			continue
+		}
+
+		if err := m.exec(component, m.dbType, mg, true); err != nil {
+			return fmt.Errorf("rollback: %v: %w", mg.Filename, err)
+		}
+	}
+
+	return nil
+}
+
+// Check compares the applied migrations with the ones in the filesystem without changing
+// anything, so it's cheap enough to run on every start
+func (m *Migrator) Check(fs *embed.FS, component string) error {
+	// parse migrations
+	migrations, err := m.parse(fs)
+	if err != nil {
+		return fmt.Errorf("parse: %w", err)
+	}
+
+	// the table is missing on a fresh database, any other error means it can't be reached
+	exists, err := m.schemaExists()
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: no migrations applied", ErrPending)
+	}
+
+	// get current migration versions
+	versions, err := m.versions(component, m.dbType)
+	if err != nil {
+		return fmt.Errorf("versions: %v: %w", component, err)
+	}
+
+	pending := make([]int, 0)
+	for _, mg := range migrations {
+		if !versions[mg.Version] {
+			pending = append(pending, mg.Version)
+		}
+		delete(versions, mg.Version)
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d pending migrations, starting at version %d", ErrPending, len(pending), pending[0])
+	}
+	if len(versions) > 0 {
+		return fmt.Errorf("%w: %d migrations applied by a newer release", ErrNewer, len(versions))
+	}
+
+	return nil
+}
@@ -3,9 +3,13 @@ package migrate
 import (
 	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
 	"path"
 	"sort"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
 )
 
 type migration struct {
@@ -13,6 +17,7 @@ type migration struct {
 	Name     string `regroup:"Name"`
 	Filename string
 	Schema   string
+	Down     string
 }
 
 func (m *Migrator) verify() error {
@@ -22,6 +27,15 @@ func (m *Migrator) verify() error {
 	return nil
 }
 
+// schemaExists reports whether the schema_migration table was created
+func (m *Migrator) schemaExists() (bool, error) {
+	var count int
+	if err := m.db.QueryRow(sqlSchemaExists(m.dbType)).Scan(&count); err != nil {
+		return false, fmt.Errorf("schema: %w", err)
+	}
+	return count > 0, nil
+}
+
 func (m *Migrator) versions(component string, dbType string) (map[int]bool, error) {
 	rows, err := m.db.Query(sqlVersions(dbType), component)
 	if err != nil {
@@ -42,7 +56,8 @@ func (m *Migrator) versions(component string, dbType string) (map[int]bool, erro
 	return versions, nil
 }
 
-func (m *Migrator) exec(component string, dbType string, migration *migration) (err error) {
+// exec applies the migration, or reverts it with its down script
+func (m *Migrator) exec(component string, dbType string, migration *migration, down bool) (err error) {
 	// begin tx
 	tx, err := m.db.Begin()
 	if err != nil {
@@ -65,8 +80,22 @@ func (m *Migrator) exec(component string, dbType string, migration *migration) (
 		}
 	}(tx)
 
+	if down {
+		// exec down migration
+		if err := execScript(tx, dbType, migration.Down); err != nil {
+			return fmt.Errorf("exec: %w", err)
+		}
+
+		// delete migration version
+		if _, err := tx.Exec(sqlDeleteVersion(dbType), component, migration.Version); err != nil {
+			return fmt.Errorf("schema_migration: %w", err)
+		}
+
+		return nil
+	}
+
 	// exec migration
-	if _, err := tx.Exec(migration.Schema); err != nil {
+	if err := execScript(tx, dbType, migration.Schema); err != nil {
 		return fmt.Errorf("exec: %w", err)
 	}
 
@@ -78,6 +107,48 @@ func (m *Migrator) exec(component string, dbType string, migration *migration) (
 	return nil
 }
 
+// execScript runs the statements of a migration. mysql commits every DDL statement on its own,
+// so a migration failing halfway there can't be rolled back. Its statements run one by one
+// instead, and running the migration again skips the steps the failed attempt already applied.
+func execScript(tx *sql.Tx, dbType string, script string) error {
+	if dbType != "mysql" {
+		_, err := tx.Exec(script)
+		return err
+	}
+
+	for _, statement := range strings.Split(script, ";") {
+		statement = strings.TrimSpace(statement)
+		if statement == "" {
+			continue
+		}
+		if _, err := tx.Exec(statement); err != nil && !applied(err) {
+			first, _, _ := strings.Cut(statement, "\n")
+			return fmt.Errorf("%s: %w", first, err)
+		}
+	}
+	return nil
+}
+
+// applied reports whether a mysql statement failed because it was applied already
+func applied(err error) bool {
+	mysqlErr := &mysql.MySQLError{}
+	if !errors.As(err, &mysqlErr) {
+		return false
+	}
+	switch mysqlErr.Number {
+	case 1050, // table exists
+		1060, // column exists
+		1061, // index exists
+		1091, // dropped column, index or foreign key is missing
+		1826: // foreign key exists
+		return true
+	case 1005:
+		// mariadb reports existing foreign keys as a failure to create the table
+		return strings.Contains(mysqlErr.Message, "errno: 121")
+	}
+	return false
+}
+
 func (m *Migrator) parse(fs *embed.FS) ([]*migration, error) {
 	// parse migrations from filesystem
 	files, err := fs.ReadDir(m.dir)
@@ -87,6 +158,7 @@ func (m *Migrator) parse(fs *embed.FS) ([]*migration, error) {
 
 	// parse migrations
 	migrations := make([]*migration, 0)
+	downs := make(map[int]string)
 	for _, f := range files {
 		// skip dirs
 		if f.IsDir() {
@@ -103,6 +175,12 @@ func (m *Migrator) parse(fs *embed.FS) ([]*migration, error) {
 		if err != nil {
 			return nil, fmt.Errorf("read migration: %w", err)
 		}
+
+		// down migrations revert the migration of the same version
+		if strings.HasSuffix(f.Name(), ".down.sql") {
+			downs[md.Version] = string(b)
+			continue
+		}
 		md.Schema = string(b)
 		md.Filename = f.Name()
 
@@ -110,6 +188,10 @@ func (m *Migrator) parse(fs *embed.FS) ([]*migration, error) {
 		migrations = append(migrations, md)
 	}
 
+	for _, md := range migrations {
+		md.Down = downs[md.Version]
+	}
+
 	// sort migrations
 	sort.Slice(migrations, func(i, j int) bool {
 		return migrations[i].Version < migrations[j].Version
@@ -120,6 +202,18 @@ func (m *Migrator) parse(fs *embed.FS) ([]*migration, error) {
 
 const sqlSchema = `CREATE TABLE IF NOT EXISTS schema_migration (component VARCHAR(255) NOT NULL, version INTEGER NOT NULL, PRIMARY KEY (component, version))`
 
+// sqlSchemaExists counts the schema_migration tables, there is none on a fresh database
+func sqlSchemaExists(dbType string) string {
+	switch dbType {
+	case "postgres":
+		return `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_migration'`
+	case "mysql":
+		return `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = 'schema_migration'`
+	default:
+		return `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migration'`
+	}
+}
+
 func sqlVersions(dbType string) string {
 	if dbType == "postgres" {
 		return `SELECT version FROM schema_migration WHERE component = $1`
@@ -134,3 +228,10 @@ func sqlInsertVersion(dbType string) string {
 		return `INSERT INTO schema_migration (component, version) VALUES (?, ?)`
 	}
 }
+func sqlDeleteVersion(dbType string) string {
+	if dbType == "postgres" {
+		return `DELETE FROM schema_migration WHERE component = $1 AND version = $2`
+	} else {
+		return `DELETE FROM schema_migration WHERE component = ? AND version = ?`
+	}
+}
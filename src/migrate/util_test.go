@@ -0,0 +1,32 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestApplied(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&mysql.MySQLError{Number: 1060, Message: "Duplicate column name 'fallback'"}, true},
+		{fmt.Errorf("exec: %w", &mysql.MySQLError{Number: 1061, Message: "Duplicate key name 'hosts_fallback'"}), true},
+		{&mysql.MySQLError{Number: 1826, Message: "Duplicate foreign key constraint name 'processes_host_id_fkey'"}, true},
+		{&mysql.MySQLError{Number: 1091, Message: "Can't DROP 'fallback'; check that column/key exists"}, true},
+		{&mysql.MySQLError{Number: 1005, Message: "Can't create table `ffmpegof`.`processes` (errno: 121 \"Duplicate key on write or update\")"}, true},
+		{&mysql.MySQLError{Number: 1005, Message: "Can't create table `ffmpegof`.`processes` (errno: 150 \"Foreign key constraint is incorrectly formed\")"}, false},
+		{&mysql.MySQLError{Number: 1062, Message: "Duplicate entry '1' for key 'hosts_fallback'"}, false},
+		{&mysql.MySQLError{Number: 1146, Message: "Table 'ffmpegof.hosts' doesn't exist"}, false},
+		{errors.New("driver: bad connection"), false},
+	}
+
+	for _, test := range tests {
+		if got := applied(test.err); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.err, got, test.want)
+		}
+	}
+}
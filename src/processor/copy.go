@@ -0,0 +1,112 @@
+package processor
+
+import (
+	"fmt"
+)
+
+// Copied counts the rows copied from one database to another
+type Copied struct {
+	Hosts int
+	Jobs  int
+}
+
+// Copy copies the hosts and the history of from into to, in one transaction. Processes and
+// states belong to wrappers running against from, so they aren't copied. A destination that
+// already has hosts or jobs is only overwritten when forced.
+func Copy(from *Processor, to *Processor, force bool) (Copied, error) {
+	hosts, err := from.GetHosts()
+	if err != nil {
+		return Copied{}, fmt.Errorf("source hosts: %w", err)
+	}
+	fallback, err := from.GetFallbackHost()
+	if err != nil {
+		return Copied{}, fmt.Errorf("source fallback host: %w", err)
+	}
+	jobs, err := from.GetJobs(JobFilter{})
+	if err != nil {
+		return Copied{}, fmt.Errorf("source jobs: %w", err)
+	}
+
+	existingHosts, err := to.GetHosts()
+	if err != nil {
+		return Copied{}, fmt.Errorf("destination hosts: %w", err)
+	}
+	existingJobs, err := to.GetJobs(JobFilter{Limit: 1})
+	if err != nil {
+		return Copied{}, fmt.Errorf("destination jobs: %w", err)
+	}
+	if (len(existingHosts) > 0 || len(existingJobs) > 0) && !force {
+		return Copied{}, fmt.Errorf("destination already has hosts or jobs, use --force to overwrite them")
+	}
+
+	err = to.Transaction(func(to *Processor) error {
+		for _, host := range existingHosts {
+			if err := to.RemoveHost(host); err != nil {
+				return fmt.Errorf("remove %s: %w", host.Servername, err)
+			}
+		}
+		if err := to.RemoveProcesses(); err != nil {
+			return err
+		}
+		if err := to.RemoveStates(); err != nil {
+			return err
+		}
+		if err := to.RemoveJobs(); err != nil {
+			return err
+		}
+
+		for _, host := range hosts {
+			if err := to.AddHost(host); err != nil {
+				return fmt.Errorf("add %s: %w", host.Servername, err)
+			}
+		}
+
+		// hosts get new ids, the jobs are pointed at them
+		copiedHosts, err := to.GetHosts()
+		if err != nil {
+			return err
+		}
+		toFallback, err := to.GetFallbackHost()
+		if err != nil {
+			return err
+		}
+		added := make(map[string]int, len(hosts))
+		for _, host := range copiedHosts {
+			added[host.Servername] = host.Id
+		}
+		ids := map[int]int{fallback.Id: toFallback.Id}
+		for _, host := range hosts {
+			ids[host.Id] = added[host.Servername]
+		}
+
+		// jobs come newest first, they're added oldest first to keep the order of their ids
+		for index := len(jobs) - 1; index >= 0; index-- {
+			job := jobs[index]
+			job.HostId = ids[job.HostId]
+			if err := to.AddJob(job); err != nil {
+				return fmt.Errorf("add job %d: %w", job.Id, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Copied{}, err
+	}
+
+	// the row counts must match, or something was silently lost on the way
+	copied := Copied{}
+	copiedHosts, err := to.GetHosts()
+	if err != nil {
+		return copied, fmt.Errorf("count destination hosts: %w", err)
+	}
+	copiedJobs, err := to.GetJobs(JobFilter{})
+	if err != nil {
+		return copied, fmt.Errorf("count destination jobs: %w", err)
+	}
+	copied.Hosts, copied.Jobs = len(copiedHosts), len(copiedJobs)
+	if copied.Hosts != len(hosts) || copied.Jobs != len(jobs) {
+		return copied, fmt.Errorf("row counts don't match: %d of %d hosts and %d of %d jobs copied",
+			copied.Hosts, len(hosts), copied.Jobs, len(jobs))
+	}
+	return copied, nil
+}
@@ -2,54 +2,164 @@ package processor
 
 import (
 	"embed"
+	"errors"
 	"fmt"
 
 	"database/sql"
 
+	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
 	_ "modernc.org/sqlite"
 
 	"github.com/tminaorg/ffmpegof/src/migrate"
 )
 
+// querier runs statements on the database, or on the transaction in progress
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// transaction is begun by the statements that need one
+type transaction interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Commit() error
+	Rollback() error
+}
+
 type datastore struct {
-	*sql.DB
+	querier
+	db     *sql.DB
+	tx     *sql.Tx
 	dbType string
 }
 
+// nestedTx runs the statements of a transaction begun within Transaction, which commits or
+// rolls back all of them at the end
+type nestedTx struct {
+	*sql.Tx
+}
+
+func (nestedTx) Commit() error {
+	return nil
+}
+
+func (nestedTx) Rollback() error {
+	return nil
+}
+
+func (store *datastore) Begin() (transaction, error) {
+	if store.tx != nil {
+		return nestedTx{store.tx}, nil
+	}
+	return store.db.Begin()
+}
+
+// Transaction runs fn on a store whose changes are only committed if fn succeeds
+func (store *datastore) Transaction(fn func(store Store) error) (err error) {
+	if store.tx != nil {
+		return fn(store)
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+
+	if err = fn(&datastore{tx, store.db, tx, store.dbType}); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return fmt.Errorf("rollback: %v: %w", rollbackErr, err)
+		}
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
 //go:embed migrations/sqlite
 var migrationsSqlite embed.FS
 
 //go:embed migrations/postgres
 var migrationsPostgres embed.FS
 
-func newDatastore(db *sql.DB, dbType string, mg *migrate.Migrator) (*datastore, error) {
+//go:embed migrations/mysql
+var migrationsMysql embed.FS
+
+// migrations returns the embedded migrations of the database type
+func migrations(dbType string) (*embed.FS, error) {
 	switch dbType {
 	case "sqlite":
-		{
-			// migrations/sqlite
-			if err := mg.Migrate(&migrationsSqlite, "processor"); err != nil {
-				return nil, fmt.Errorf("migrate: %w", err)
-			}
-		}
+		// migrations/sqlite
+		return &migrationsSqlite, nil
 	case "postgres":
-		{
-			// migrations/postgres
-			if err := mg.Migrate(&migrationsPostgres, "processor"); err != nil {
-				return nil, fmt.Errorf("migrate: %w", err)
-			}
-		}
+		// migrations/postgres
+		return &migrationsPostgres, nil
+	case "mysql":
+		// migrations/mysql
+		return &migrationsMysql, nil
 	default:
-		return &datastore{}, fmt.Errorf("incorrect database type")
+		return nil, fmt.Errorf("incorrect database type")
+	}
+}
+
+// newDatastore only checks the schema, migrating is left to "ffmpegof db migrate" so the
+// wrappers starting at once don't race each other
+func newDatastore(db *sql.DB, dbType string, mg *migrate.Migrator) (*datastore, error) {
+	fs, err := migrations(dbType)
+	if err != nil {
+		return &datastore{}, err
+	}
+	err = mg.Check(fs, "processor")
+	switch {
+	case errors.Is(err, migrate.ErrPending):
+		return nil, fmt.Errorf("check: %w, run \"ffmpegof db migrate\"", err)
+	case errors.Is(err, migrate.ErrNewer):
+		return nil, fmt.Errorf("check: %w, upgrade ffmpegof", err)
+	case err != nil:
+		return nil, fmt.Errorf("check: %w", err)
+	}
+	return &datastore{db, db, nil, dbType}, nil
+}
+
+// Migrate applies the pending migrations of the database type
+func Migrate(dbType string, mg *migrate.Migrator) error {
+	fs, err := migrations(dbType)
+	if err != nil {
+		return err
+	}
+	if err := mg.Migrate(fs, "processor"); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	return nil
+}
+
+// MigrationStatus lists the migrations of the database type and whether they were applied
+func MigrationStatus(dbType string, mg *migrate.Migrator) ([]migrate.Status, error) {
+	fs, err := migrations(dbType)
+	if err != nil {
+		return nil, err
+	}
+	return mg.Status(fs, "processor")
+}
+
+// Rollback reverts the migrations of the database type newer than the version
+func Rollback(dbType string, mg *migrate.Migrator, version int) error {
+	fs, err := migrations(dbType)
+	if err != nil {
+		return err
 	}
-	return &datastore{db, dbType}, nil
+	return mg.Rollback(fs, "processor", version)
 }
 
 func sqlSelectVersion(dbType string) (string, error) {
 	switch dbType {
 	case "sqlite":
 		return "sqlite", nil
-	case "postgres":
+	case "postgres", "mysql":
 		return `SELECT version()`, nil
 	default:
 		return "", fmt.Errorf("incorrect database type")
@@ -13,20 +13,33 @@ import (
 func sqlUpsertHost(dbType string) (string, error) {
 	switch dbType {
 	case "sqlite":
-		return `INSERT INTO hosts (servername, hostname, weight, created)
-				VALUES (?, ?, ?, ?)
+		return `INSERT INTO hosts (servername, hostname, weight, created, transport)
+				VALUES (?, ?, ?, ?, ?)
 				ON CONFLICT (servername) DO UPDATE SET
 				    hostname = excluded.hostname,
 				    weight = excluded.weight,
-				    created = excluded.created
+				    created = excluded.created,
+				    transport = excluded.transport
+				WHERE NOT hosts.fallback
+				`, nil
+	case "mysql":
+		return `INSERT INTO hosts (servername, hostname, weight, created, transport)
+				VALUES (?, ?, ?, ?, ?)
+				ON DUPLICATE KEY UPDATE
+				    hostname = IF(fallback, hostname, VALUES(hostname)),
+				    weight = IF(fallback, weight, VALUES(weight)),
+				    created = IF(fallback, created, VALUES(created)),
+				    transport = IF(fallback, transport, VALUES(transport))
 				`, nil
 	case "postgres":
-		return `INSERT INTO hosts (servername, hostname, weight, created)
-				VALUES ($1, $2, $3, $4)
+		return `INSERT INTO hosts (servername, hostname, weight, created, transport)
+				VALUES ($1, $2, $3, $4, $5)
 				ON CONFLICT (servername) DO UPDATE SET
 				    hostname = excluded.hostname,
 				    weight = excluded.weight,
-				    created = excluded.created
+				    created = excluded.created,
+				    transport = excluded.transport
+				WHERE NOT hosts.fallback
 				`, nil
 	default:
 		return "", fmt.Errorf("incorrect database type")
@@ -44,7 +57,7 @@ func (store *datastore) UpsertHost(host Host) error {
 		return err
 	}
 
-	if _, err = tx.Exec(sqlUpsertHost, host.Servername, host.Hostname, host.Weight, host.Created); err != nil {
+	if _, err = tx.Exec(sqlUpsertHost, host.Servername, host.Hostname, host.Weight, host.Created, host.Transport); err != nil {
 		if rollbackErr := tx.Rollback(); rollbackErr != nil {
 			panic(rollbackErr)
 		}
@@ -54,24 +67,90 @@ func (store *datastore) UpsertHost(host Host) error {
 	return tx.Commit()
 }
 
-// func sqlDeleteHosts(dbType string) (string, error) {
-// 	switch dbType {
-// 	case "sqlite":
-// 		return `DELETE FROM hosts`, nil
-// 	case "postgres":
-// 		return `DELETE FROM hosts`, nil
-// 	default:
-// 		return "", fmt.Errorf("incorrect database type")
-// 	}
-// }
+func sqlUpdateHost(dbType string) (string, error) {
+	switch dbType {
+	case "sqlite", "mysql":
+		return `UPDATE hosts SET servername=?, hostname=?, weight=?, transport=? WHERE id=? AND NOT fallback`, nil
+	case "postgres":
+		return `UPDATE hosts SET servername=$1, hostname=$2, weight=$3, transport=$4 WHERE id=$5 AND NOT fallback`, nil
+	default:
+		return "", fmt.Errorf("incorrect database type")
+	}
+}
+
+func sqlUpdateJobsServername(dbType string) (string, error) {
+	switch dbType {
+	case "sqlite", "mysql":
+		return `UPDATE jobs SET servername=? WHERE host_id=?`, nil
+	case "postgres":
+		return `UPDATE jobs SET servername=$1 WHERE host_id=$2`, nil
+	default:
+		return "", fmt.Errorf("incorrect database type")
+	}
+}
+
+// UpdateHost changes the host with the id of host in place, keeping its created time. The jobs
+// of the host follow a new name, so its history stays under it.
+func (store *datastore) UpdateHost(host Host) error {
+	sqlUpdateHost, err := sqlUpdateHost(store.dbType)
+	if err != nil {
+		return err
+	}
+	sqlUpdateJobsServername, err := sqlUpdateJobsServername(store.dbType)
+	if err != nil {
+		return err
+	}
+
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(sqlUpdateHost, host.Servername, host.Hostname, host.Weight, host.Transport, host.Id)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			panic(rollbackErr)
+		}
+		return fmt.Errorf("update host: %w", err)
+	}
+	// mysql counts the matched rows, not only the changed ones, as the connection sets CLIENT_FOUND_ROWS
+	if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			panic(rollbackErr)
+		}
+		if err != nil {
+			return fmt.Errorf("update host: %w", err)
+		}
+		return fmt.Errorf("update host: %w", ErrHostNotFound)
+	}
+	if _, err = tx.Exec(sqlUpdateJobsServername, host.Servername, host.Id); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			panic(rollbackErr)
+		}
+		return fmt.Errorf("update jobs of host: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+func sqlDeleteHosts(dbType string) (string, error) {
+	switch dbType {
+	case "sqlite", "mysql":
+		return `DELETE FROM hosts WHERE NOT fallback`, nil
+	case "postgres":
+		return `DELETE FROM hosts WHERE NOT fallback`, nil
+	default:
+		return "", fmt.Errorf("incorrect database type")
+	}
+}
 
 func (store *datastore) DeleteHosts() error {
-	sqlDeleteHost, err := sqlDeleteHost(store.dbType)
+	sqlDeleteHosts, err := sqlDeleteHosts(store.dbType)
 	if err != nil {
 		return err
 	}
 
-	_, err = store.Exec(sqlDeleteHost)
+	_, err = store.Exec(sqlDeleteHosts)
 	if err != nil {
 		return fmt.Errorf("delete hosts: %w", err)
 	}
@@ -81,10 +160,10 @@ func (store *datastore) DeleteHosts() error {
 
 func sqlDeleteHost(dbType string) (string, error) {
 	switch dbType {
-	case "sqlite":
-		return `DELETE FROM hosts WHERE servername=?`, nil
+	case "sqlite", "mysql":
+		return `DELETE FROM hosts WHERE servername=? AND NOT fallback`, nil
 	case "postgres":
-		return `DELETE FROM hosts WHERE servername=$1`, nil
+		return `DELETE FROM hosts WHERE servername=$1 AND NOT fallback`, nil
 	default:
 		return "", fmt.Errorf("incorrect database type")
 	}
@@ -106,10 +185,10 @@ func (store *datastore) DeleteHost(host Host) error {
 
 func sqlSelectCountHosts(dbType string) (string, error) {
 	switch dbType {
-	case "sqlite":
-		return `SELECT COUNT(id) FROM hosts`, nil
+	case "sqlite", "mysql":
+		return `SELECT COUNT(id) FROM hosts WHERE NOT fallback`, nil
 	case "postgres":
-		return `SELECT COUNT(id) FROM hosts`, nil
+		return `SELECT COUNT(id) FROM hosts WHERE NOT fallback`, nil
 	default:
 		return "", fmt.Errorf("incorrect database type")
 	}
@@ -137,10 +216,10 @@ func (store *datastore) SelectCountHosts() (int, error) {
 
 func sqlSelectHosts(dbType string) (string, error) {
 	switch dbType {
-	case "sqlite":
-		return `SELECT * FROM hosts ORDER BY created ASC`, nil
+	case "sqlite", "mysql":
+		return `SELECT id, servername, hostname, weight, created, transport, fallback FROM hosts WHERE NOT fallback ORDER BY created ASC`, nil
 	case "postgres":
-		return `SELECT * FROM hosts ORDER BY created ASC`, nil
+		return `SELECT id, servername, hostname, weight, created, transport, fallback FROM hosts WHERE NOT fallback ORDER BY created ASC`, nil
 	default:
 		return "", fmt.Errorf("incorrect database type")
 	}
@@ -160,7 +239,7 @@ func (store *datastore) SelectHosts() (hosts []Host, err error) {
 	defer rows.Close()
 	for rows.Next() {
 		host := Host{}
-		err = rows.Scan(&host.Id, &host.Servername, &host.Hostname, &host.Weight, &host.Created)
+		err = rows.Scan(&host.Id, &host.Servername, &host.Hostname, &host.Weight, &host.Created, &host.Transport, &host.Fallback)
 		if err != nil {
 			return hosts, err
 		}
@@ -171,9 +250,37 @@ func (store *datastore) SelectHosts() (hosts []Host, err error) {
 	return hosts, rows.Err()
 }
 
+func sqlSelectFallbackHost(dbType string) (string, error) {
+	switch dbType {
+	case "sqlite", "mysql":
+		return `SELECT id, servername, hostname, weight, created, transport, fallback FROM hosts WHERE fallback`, nil
+	case "postgres":
+		return `SELECT id, servername, hostname, weight, created, transport, fallback FROM hosts WHERE fallback`, nil
+	default:
+		return "", fmt.Errorf("incorrect database type")
+	}
+}
+
+// SelectFallbackHost returns the row standing in for localhost when no other host can be used
+func (store *datastore) SelectFallbackHost() (Host, error) {
+	host := Host{}
+	sqlSelectFallbackHost, err := sqlSelectFallbackHost(store.dbType)
+	if err != nil {
+		return host, err
+	}
+
+	row := store.QueryRow(sqlSelectFallbackHost)
+	err = row.Scan(&host.Id, &host.Servername, &host.Hostname, &host.Weight, &host.Created, &host.Transport, &host.Fallback)
+	if err != nil {
+		return host, fmt.Errorf("select fallback host: %w", err)
+	}
+
+	return host, nil
+}
+
 func sqlSelectHostsWhere(dbType string) (string, error) {
 	switch dbType {
-	case "sqlite":
+	case "sqlite", "mysql":
 		return `SELECT %s FROM hosts WHERE %s=? ORDER BY created ASC`, nil
 	case "postgres":
 		return `SELECT %s FROM hosts WHERE %s=$1 ORDER BY created ASC`, nil
@@ -187,7 +294,7 @@ func (store *datastore) SelectHostsWhere(fieldType string, field string) (hosts
 	if err != nil {
 		return hosts, err
 	}
-	sqlSelectHostsWhere = fmt.Sprintf(sqlSelectHostsWhere, "*", fieldType)
+	sqlSelectHostsWhere = fmt.Sprintf(sqlSelectHostsWhere, "id, servername, hostname, weight, created, transport, fallback", fieldType)
 
 	rows, err := store.Query(sqlSelectHostsWhere, field)
 	if err != nil {
@@ -197,7 +304,7 @@ func (store *datastore) SelectHostsWhere(fieldType string, field string) (hosts
 	defer rows.Close()
 	for rows.Next() {
 		host := Host{}
-		err = rows.Scan(&host.Id, &host.Servername, &host.Hostname, &host.Weight, &host.Created)
+		err = rows.Scan(&host.Id, &host.Servername, &host.Hostname, &host.Weight, &host.Created, &host.Transport, &host.Fallback)
 		if err != nil {
 			return hosts, err
 		}
@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tminaorg/ffmpegof/src/migrate"
+)
+
+func testUpdateHost(t *testing.T, store Store) {
+	if err := store.UpsertHost(Host{Servername: "one", Hostname: "one", Weight: 1, Created: time.Now(), Transport: "ssh"}); err != nil {
+		t.Fatal(err)
+	}
+	hosts, err := store.SelectHostsWhere("servername", "one")
+	if err != nil || len(hosts) != 1 {
+		t.Fatalf("select host: %v", err)
+	}
+
+	// unchanged values still match the host
+	host := hosts[0]
+	if err := store.UpdateHost(host); err != nil {
+		t.Errorf("update host: %s", err)
+	}
+	host.Weight = 3
+	if err := store.UpdateHost(host); err != nil {
+		t.Errorf("update host: %s", err)
+	}
+
+	unknown := host
+	unknown.Id = 99
+	unknown.Servername = "unknown"
+	if err := store.UpdateHost(unknown); !errors.Is(err, ErrHostNotFound) {
+		t.Errorf("update unknown host: got %v, want %v", err, ErrHostNotFound)
+	}
+
+	fallback, err := store.SelectFallbackHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fallback.Weight = 3
+	if err := store.UpdateHost(fallback); !errors.Is(err, ErrHostNotFound) {
+		t.Errorf("update fallback: got %v, want %v", err, ErrHostNotFound)
+	}
+}
+
+func TestUpdateHostMemory(t *testing.T) {
+	testUpdateHost(t, NewMemoryStore())
+}
+
+func TestUpdateHostSqlite(t *testing.T) {
+	db := openSqlite(t)
+	mg, err := migrate.New(db, "sqlite", "migrations/sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate("sqlite", mg); err != nil {
+		t.Fatal(err)
+	}
+	store, err := newDatastore(db, "sqlite", mg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testUpdateHost(t, store)
+}
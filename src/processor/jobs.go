@@ -0,0 +1,171 @@
+package processor
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+func sqlPlaceholder(dbType string, index int) (string, error) {
+	switch dbType {
+	case "sqlite", "mysql":
+		return "?", nil
+	case "postgres":
+		return fmt.Sprintf("$%d", index), nil
+	default:
+		return "", fmt.Errorf("incorrect database type")
+	}
+}
+
+func sqlInsertJob(dbType string) (string, error) {
+	switch dbType {
+	case "sqlite", "mysql":
+		return `INSERT INTO jobs (host_id, servername, process_id, class, cmd, started, ended, status, exit_code, reason, retries, overhead, instance)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, nil
+	case "postgres":
+		return `INSERT INTO jobs (host_id, servername, process_id, class, cmd, started, ended, status, exit_code, reason, retries, overhead, instance)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`, nil
+	default:
+		return "", fmt.Errorf("incorrect database type")
+	}
+}
+
+func (store *datastore) InsertJob(job Job) error {
+	sqlInsertJob, err := sqlInsertJob(store.dbType)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.Exec(sqlInsertJob,
+		job.HostId, job.Servername, job.ProcessId, job.Class, job.Cmd, job.Started.UTC(), job.Ended.UTC(),
+		job.Status, job.ExitCode, job.Reason, job.Retries, job.Overhead.Milliseconds(), job.Instance)
+	if err != nil {
+		return fmt.Errorf("insert job: %w", err)
+	}
+
+	return nil
+}
+
+func sqlDeleteJobs(dbType string) (string, error) {
+	switch dbType {
+	case "sqlite", "mysql":
+		return `DELETE FROM jobs`, nil
+	case "postgres":
+		return `DELETE FROM jobs`, nil
+	default:
+		return "", fmt.Errorf("incorrect database type")
+	}
+}
+
+func (store *datastore) DeleteJobs() error {
+	sqlDeleteJobs, err := sqlDeleteJobs(store.dbType)
+	if err != nil {
+		return err
+	}
+
+	if _, err = store.Exec(sqlDeleteJobs); err != nil {
+		return fmt.Errorf("delete jobs: %w", err)
+	}
+
+	return nil
+}
+
+func sqlDeleteJobsBefore(dbType string) (string, error) {
+	switch dbType {
+	case "sqlite", "mysql":
+		return `DELETE FROM jobs WHERE started<?`, nil
+	case "postgres":
+		return `DELETE FROM jobs WHERE started<$1`, nil
+	default:
+		return "", fmt.Errorf("incorrect database type")
+	}
+}
+
+func (store *datastore) DeleteJobsBefore(before time.Time) error {
+	sqlDeleteJobsBefore, err := sqlDeleteJobsBefore(store.dbType)
+	if err != nil {
+		return err
+	}
+
+	if _, err = store.Exec(sqlDeleteJobsBefore, before.UTC()); err != nil {
+		return fmt.Errorf("delete jobs before: %w", err)
+	}
+
+	return nil
+}
+
+// sqlSelectJobsWhere builds the query for the conditions set in the filter, newest jobs first
+func sqlSelectJobsWhere(dbType string, filter JobFilter) (string, []any, error) {
+	conditions := make([]string, 0)
+	values := make([]any, 0)
+	add := func(condition string, value any) error {
+		placeholder, err := sqlPlaceholder(dbType, len(values)+1)
+		if err != nil {
+			return err
+		}
+		conditions = append(conditions, condition+placeholder)
+		values = append(values, value)
+		return nil
+	}
+
+	var err error
+	if filter.Servername != "" {
+		err = add("servername=", filter.Servername)
+	}
+	if err == nil && !filter.Since.IsZero() {
+		err = add("started>=", filter.Since.UTC())
+	}
+	if err == nil && !filter.Until.IsZero() {
+		err = add("started<=", filter.Until.UTC())
+	}
+	if err == nil && filter.Status != "" {
+		err = add("status=", filter.Status)
+	}
+	if err == nil && filter.Class != "" {
+		err = add("class=", filter.Class)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	query := `SELECT * FROM jobs`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+	query += ` ORDER BY started DESC`
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(` LIMIT %d`, filter.Limit)
+	}
+	return query, values, nil
+}
+
+func (store *datastore) SelectJobsWhere(filter JobFilter) (jobs []Job, err error) {
+	sqlSelectJobsWhere, values, err := sqlSelectJobsWhere(store.dbType, filter)
+	if err != nil {
+		return jobs, err
+	}
+
+	rows, err := store.Query(sqlSelectJobsWhere, values...)
+	if err != nil {
+		return jobs, err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		job := Job{}
+		overhead := int64(0)
+		err = rows.Scan(&job.Id, &job.HostId, &job.Servername, &job.ProcessId, &job.Class, &job.Cmd, &job.Started, &job.Ended,
+			&job.Status, &job.ExitCode, &job.Reason, &job.Retries, &overhead, &job.Instance)
+		if err != nil {
+			return jobs, err
+		}
+		job.Overhead = time.Duration(overhead) * time.Millisecond
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
@@ -0,0 +1,566 @@
+package processor
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryStore keeps everything in the memory of a single process, nothing survives its exit
+type memoryStore struct {
+	// transactions are serialised, their changes are undone if they fail
+	txMu sync.Mutex
+
+	mu        sync.Mutex
+	hosts     []Host
+	processes []Process
+	states    []State
+	jobs      []Job
+	// last ids handed out, like the auto increment columns of the datastore
+	lastHost    int
+	lastProcess int
+	lastState   int
+	lastJob     int
+}
+
+// NewMemoryStore returns an empty in-memory store holding only the fallback host
+func NewMemoryStore() Store {
+	store := &memoryStore{}
+	store.lastHost++
+	store.hosts = append(store.hosts, Host{
+		Id:         store.lastHost,
+		Servername: "localhost (fallback)",
+		Hostname:   "localhost",
+		Weight:     0,
+		Created:    time.Now(),
+		Transport:  "local",
+		Fallback:   true,
+	})
+	return store
+}
+
+func (store *memoryStore) SelectVersion() (string, error) {
+	return "memory", nil
+}
+
+func (store *memoryStore) Transaction(fn func(store Store) error) error {
+	store.txMu.Lock()
+	defer store.txMu.Unlock()
+
+	store.mu.Lock()
+	hosts := append([]Host(nil), store.hosts...)
+	processes := append([]Process(nil), store.processes...)
+	states := append([]State(nil), store.states...)
+	jobs := append([]Job(nil), store.jobs...)
+	store.mu.Unlock()
+
+	if err := fn(store); err != nil {
+		store.mu.Lock()
+		store.hosts, store.processes, store.states, store.jobs = hosts, processes, states, jobs
+		store.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// hosts
+func (store *memoryStore) hostExists(id int) bool {
+	for _, host := range store.hosts {
+		if host.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (store *memoryStore) UpsertHost(host Host) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for index, existing := range store.hosts {
+		if existing.Servername == host.Servername {
+			if existing.Fallback {
+				return nil
+			}
+			existing.Hostname = host.Hostname
+			existing.Weight = host.Weight
+			existing.Created = host.Created
+			existing.Transport = host.Transport
+			store.hosts[index] = existing
+			return nil
+		}
+	}
+
+	store.lastHost++
+	store.hosts = append(store.hosts, Host{
+		Id:         store.lastHost,
+		Servername: host.Servername,
+		Hostname:   host.Hostname,
+		Weight:     host.Weight,
+		Created:    host.Created,
+		Transport:  host.Transport,
+	})
+	return nil
+}
+
+func (store *memoryStore) UpdateHost(host Host) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for index, existing := range store.hosts {
+		if existing.Id != host.Id || existing.Fallback {
+			continue
+		}
+		for _, other := range store.hosts {
+			if other.Id != host.Id && other.Servername == host.Servername {
+				return fmt.Errorf("update host: servername %s is taken", host.Servername)
+			}
+		}
+		existing.Servername = host.Servername
+		existing.Hostname = host.Hostname
+		existing.Weight = host.Weight
+		existing.Transport = host.Transport
+		store.hosts[index] = existing
+
+		for jobIndex := range store.jobs {
+			if store.jobs[jobIndex].HostId == host.Id {
+				store.jobs[jobIndex].Servername = host.Servername
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("update host: %w", ErrHostNotFound)
+}
+
+// deleteHostsWhere removes the matching hosts along with their processes and states
+func (store *memoryStore) deleteHostsWhere(match func(host Host) bool) {
+	removed := make(map[int]bool)
+	hosts := store.hosts[:0]
+	for _, host := range store.hosts {
+		if match(host) {
+			removed[host.Id] = true
+			continue
+		}
+		hosts = append(hosts, host)
+	}
+	store.hosts = hosts
+
+	store.deleteProcesses(func(process Process) bool {
+		return removed[process.HostId]
+	})
+	store.deleteStates(func(state State) bool {
+		return removed[state.HostId]
+	})
+}
+
+func (store *memoryStore) DeleteHosts() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.deleteHostsWhere(func(host Host) bool {
+		return !host.Fallback
+	})
+	return nil
+}
+
+func (store *memoryStore) DeleteHost(host Host) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.deleteHostsWhere(func(existing Host) bool {
+		return existing.Servername == host.Servername && !existing.Fallback
+	})
+	return nil
+}
+
+func (store *memoryStore) SelectCountHosts() (int, error) {
+	hosts, err := store.SelectHosts()
+	return len(hosts), err
+}
+
+// SelectHosts returns the hosts oldest first, like the datastore orders them
+func (store *memoryStore) SelectHosts() (hosts []Host, err error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, host := range store.hosts {
+		if !host.Fallback {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.SliceStable(hosts, func(i, j int) bool {
+		return hosts[i].Created.Before(hosts[j].Created)
+	})
+	return hosts, nil
+}
+
+func (store *memoryStore) SelectFallbackHost() (Host, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, host := range store.hosts {
+		if host.Fallback {
+			return host, nil
+		}
+	}
+	return Host{}, fmt.Errorf("select fallback host: no fallback host")
+}
+
+func hostField(host Host, field string) (string, error) {
+	switch field {
+	case "id":
+		return fmt.Sprintf("%d", host.Id), nil
+	case "servername":
+		return host.Servername, nil
+	case "hostname":
+		return host.Hostname, nil
+	case "weight":
+		return fmt.Sprintf("%d", host.Weight), nil
+	case "transport":
+		return host.Transport, nil
+	default:
+		return "", fmt.Errorf("select hosts where: wrong field name")
+	}
+}
+
+func (store *memoryStore) SelectHostsWhere(field string, value string) (hosts []Host, err error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, host := range store.hosts {
+		current, err := hostField(host, field)
+		if err != nil {
+			return hosts, err
+		}
+		if current == value {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.SliceStable(hosts, func(i, j int) bool {
+		return hosts[i].Created.Before(hosts[j].Created)
+	})
+	return hosts, nil
+}
+
+func (store *memoryStore) SelectHostsIdWhere(field string, value string) ([]Host, error) {
+	hosts, err := store.SelectHostsWhere(field, value)
+	for index, host := range hosts {
+		hosts[index] = Host{Id: host.Id}
+	}
+	return hosts, err
+}
+
+// processes
+func (store *memoryStore) InsertProcess(process Process) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if !store.hostExists(process.HostId) {
+		return fmt.Errorf("insert process: host %d doesn't exist", process.HostId)
+	}
+
+	store.lastProcess++
+	store.processes = append(store.processes, Process{
+		Id:        store.lastProcess,
+		HostId:    process.HostId,
+		ProcessId: process.ProcessId,
+		Cmd:       process.Cmd,
+		Started:   process.Started,
+		Updated:   process.Updated,
+		BootId:    process.BootId,
+		PidStart:  process.PidStart,
+		Instance:  process.Instance,
+	})
+	return nil
+}
+
+func (store *memoryStore) UpdateProcessProgress(process Process) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for index := range store.processes {
+		existing := &store.processes[index]
+		if existing.ProcessId != process.ProcessId || existing.Instance != process.Instance {
+			continue
+		}
+		existing.Frame = process.Frame
+		existing.Fps = process.Fps
+		existing.Speed = process.Speed
+		existing.OutTime = process.OutTime
+		existing.Bitrate = process.Bitrate
+		existing.Updated = process.Updated
+	}
+	return nil
+}
+
+func (store *memoryStore) DeleteProcesses() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.processes = nil
+	return nil
+}
+
+func (store *memoryStore) DeleteProcessesWhere(field string, process Process) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var match func(existing Process) bool
+	switch field {
+	case "id":
+		match = func(existing Process) bool { return existing.Id == process.Id }
+	case "host_id":
+		match = func(existing Process) bool { return existing.HostId == process.HostId }
+	case "process_id":
+		match = func(existing Process) bool { return existing.ProcessId == process.ProcessId }
+	case "instance":
+		match = func(existing Process) bool { return existing.Instance == process.Instance }
+	default:
+		return fmt.Errorf("delete processes where: wrong field name")
+	}
+
+	store.deleteProcesses(match)
+	return nil
+}
+
+func (store *memoryStore) DeleteProcessesOfInstance(process Process) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.deleteProcesses(func(existing Process) bool {
+		return existing.Instance == process.Instance && existing.ProcessId == process.ProcessId
+	})
+	return nil
+}
+
+func (store *memoryStore) deleteProcesses(match func(existing Process) bool) {
+	processes := store.processes[:0]
+	for _, existing := range store.processes {
+		if !match(existing) {
+			processes = append(processes, existing)
+		}
+	}
+	store.processes = processes
+}
+
+func (store *memoryStore) SelectCountProcesses() (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return len(store.processes), nil
+}
+
+func (store *memoryStore) SelectCountProcessesWhere(host Host) (int, error) {
+	processes, err := store.SelectProcessesWhere(host)
+	return len(processes), err
+}
+
+func (store *memoryStore) SelectProcesses() ([]Process, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return append([]Process(nil), store.processes...), nil
+}
+
+func (store *memoryStore) SelectProcessesId() ([]Process, error) {
+	processes, err := store.SelectProcesses()
+	for index, process := range processes {
+		processes[index] = Process{Id: process.Id}
+	}
+	return processes, err
+}
+
+// SelectProcessesWhere returns the processes of the host, newest first
+func (store *memoryStore) SelectProcessesWhere(host Host) (processes []Process, err error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for index := len(store.processes) - 1; index >= 0; index-- {
+		if store.processes[index].HostId == host.Id {
+			processes = append(processes, store.processes[index])
+		}
+	}
+	return processes, nil
+}
+
+func (store *memoryStore) SelectProcessesIdWhere(host Host) ([]Process, error) {
+	processes, err := store.SelectProcessesWhere(host)
+	for index, process := range processes {
+		processes[index] = Process{Id: process.Id}
+	}
+	return processes, err
+}
+
+// states
+func (store *memoryStore) InsertState(state State) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	if !store.hostExists(state.HostId) {
+		return fmt.Errorf("insert state: host %d doesn't exist", state.HostId)
+	}
+
+	store.lastState++
+	state.Id = store.lastState
+	store.states = append(store.states, state)
+	return nil
+}
+
+func (store *memoryStore) DeleteStates() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.states = nil
+	return nil
+}
+
+func (store *memoryStore) DeleteStatesWhere(field string, state State) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	var match func(existing State) bool
+	switch field {
+	case "id":
+		match = func(existing State) bool { return existing.Id == state.Id }
+	case "host_id":
+		match = func(existing State) bool { return existing.HostId == state.HostId }
+	case "process_id":
+		match = func(existing State) bool { return existing.ProcessId == state.ProcessId }
+	case "instance":
+		match = func(existing State) bool { return existing.Instance == state.Instance }
+	default:
+		return fmt.Errorf("delete states where: wrong field name")
+	}
+
+	store.deleteStates(match)
+	return nil
+}
+
+func (store *memoryStore) DeleteStatesOfInstance(state State) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.deleteStates(func(existing State) bool {
+		return existing.Instance == state.Instance && existing.ProcessId == state.ProcessId
+	})
+	return nil
+}
+
+func (store *memoryStore) deleteStates(match func(existing State) bool) {
+	states := store.states[:0]
+	for _, existing := range store.states {
+		if !match(existing) {
+			states = append(states, existing)
+		}
+	}
+	store.states = states
+}
+
+func (store *memoryStore) SelectCountStates() (int, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return len(store.states), nil
+}
+
+func (store *memoryStore) SelectCountStatesWhere(host Host) (int, error) {
+	states, err := store.SelectStatesWhere(host)
+	return len(states), err
+}
+
+func (store *memoryStore) SelectStates() ([]State, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	return append([]State(nil), store.states...), nil
+}
+
+func (store *memoryStore) SelectStatesId() ([]State, error) {
+	states, err := store.SelectStates()
+	for index, state := range states {
+		states[index] = State{Id: state.Id}
+	}
+	return states, err
+}
+
+// SelectStatesWhere returns the states of the host, newest first
+func (store *memoryStore) SelectStatesWhere(host Host) (states []State, err error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for index := len(store.states) - 1; index >= 0; index-- {
+		if store.states[index].HostId == host.Id {
+			states = append(states, store.states[index])
+		}
+	}
+	return states, nil
+}
+
+func (store *memoryStore) SelectStatesIdWhere(host Host) ([]State, error) {
+	states, err := store.SelectStatesWhere(host)
+	for index, state := range states {
+		states[index] = State{Id: state.Id}
+	}
+	return states, err
+}
+
+// jobs
+func (store *memoryStore) InsertJob(job Job) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.lastJob++
+	job.Id = store.lastJob
+	job.Started = job.Started.UTC()
+	job.Ended = job.Ended.UTC()
+	store.jobs = append(store.jobs, job)
+	return nil
+}
+
+func (store *memoryStore) DeleteJobs() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.jobs = nil
+	return nil
+}
+
+func (store *memoryStore) DeleteJobsBefore(before time.Time) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	jobs := store.jobs[:0]
+	for _, job := range store.jobs {
+		if !job.Started.Before(before) {
+			jobs = append(jobs, job)
+		}
+	}
+	store.jobs = jobs
+	return nil
+}
+
+// SelectJobsWhere returns the jobs matching the filter, newest first
+func (store *memoryStore) SelectJobsWhere(filter JobFilter) (jobs []Job, err error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, job := range store.jobs {
+		switch {
+		case filter.Servername != "" && job.Servername != filter.Servername,
+			!filter.Since.IsZero() && job.Started.Before(filter.Since),
+			!filter.Until.IsZero() && job.Started.After(filter.Until),
+			filter.Status != "" && job.Status != filter.Status,
+			filter.Class != "" && job.Class != filter.Class:
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].Started.After(jobs[j].Started)
+	})
+	if filter.Limit > 0 && len(jobs) > filter.Limit {
+		jobs = jobs[:filter.Limit]
+	}
+	return jobs, nil
+}
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS hosts (
+    `id` INTEGER PRIMARY KEY AUTO_INCREMENT,
+    `servername` VARCHAR(255) NOT NULL UNIQUE,
+    `hostname` VARCHAR(255) NOT NULL,
+    `weight` INTEGER DEFAULT 1,
+    `created` DATETIME NOT NULL
+);
+CREATE TABLE IF NOT EXISTS processes (
+    `id` INTEGER PRIMARY KEY AUTO_INCREMENT,
+    `host_id` INTEGER,
+    `process_id` INTEGER,
+    `cmd` TEXT
+);
+CREATE TABLE IF NOT EXISTS states (
+    `id` INTEGER PRIMARY KEY AUTO_INCREMENT,
+    `host_id` INTEGER,
+    `process_id` INTEGER,
+    `state` VARCHAR(255)
+)
@@ -0,0 +1 @@
+ALTER TABLE hosts ADD COLUMN `transport` VARCHAR(255) NOT NULL DEFAULT 'ssh'
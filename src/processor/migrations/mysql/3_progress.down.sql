@@ -0,0 +1,7 @@
+ALTER TABLE processes DROP COLUMN `frame`;
+ALTER TABLE processes DROP COLUMN `fps`;
+ALTER TABLE processes DROP COLUMN `speed`;
+ALTER TABLE processes DROP COLUMN `out_time`;
+ALTER TABLE processes DROP COLUMN `bitrate`;
+ALTER TABLE processes DROP COLUMN `started`;
+ALTER TABLE processes DROP COLUMN `updated`
@@ -0,0 +1,7 @@
+ALTER TABLE processes ADD COLUMN `frame` INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE processes ADD COLUMN `fps` DOUBLE NOT NULL DEFAULT 0;
+ALTER TABLE processes ADD COLUMN `speed` DOUBLE NOT NULL DEFAULT 0;
+ALTER TABLE processes ADD COLUMN `out_time` VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE processes ADD COLUMN `bitrate` VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE processes ADD COLUMN `started` DATETIME(6);
+ALTER TABLE processes ADD COLUMN `updated` DATETIME(6)
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS jobs (
+    `id` INTEGER PRIMARY KEY AUTO_INCREMENT,
+    `host_id` INTEGER NOT NULL,
+    `servername` VARCHAR(255) NOT NULL,
+    `process_id` INTEGER NOT NULL,
+    `class` VARCHAR(255) NOT NULL,
+    `cmd` TEXT NOT NULL,
+    `started` DATETIME(6) NOT NULL,
+    `ended` DATETIME(6) NOT NULL,
+    `status` VARCHAR(255) NOT NULL,
+    `exit_code` INTEGER NOT NULL,
+    `reason` TEXT NOT NULL,
+    `retries` INTEGER NOT NULL DEFAULT 0,
+    `overhead` BIGINT NOT NULL DEFAULT 0,
+    INDEX jobs_started (`started`)
+)
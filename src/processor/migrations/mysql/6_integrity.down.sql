@@ -0,0 +1,19 @@
+ALTER TABLE processes DROP FOREIGN KEY processes_host_id_fkey;
+DROP INDEX processes_host_id_fkey ON processes;
+DROP INDEX processes_process_id ON processes;
+ALTER TABLE processes MODIFY `host_id` INTEGER;
+UPDATE processes SET `host_id` = 0 WHERE `host_id` = (SELECT `id` FROM hosts WHERE `fallback`);
+
+ALTER TABLE states DROP FOREIGN KEY states_host_id_fkey;
+DROP INDEX states_host_id_fkey ON states;
+DROP INDEX states_process_id ON states;
+ALTER TABLE states MODIFY `host_id` INTEGER;
+UPDATE states SET `host_id` = 0 WHERE `host_id` = (SELECT `id` FROM hosts WHERE `fallback`);
+
+UPDATE jobs SET `host_id` = 0 WHERE `host_id` = (SELECT `id` FROM hosts WHERE `fallback`);
+DROP INDEX jobs_host_id ON jobs;
+
+DELETE FROM hosts WHERE `fallback`;
+DROP INDEX hosts_fallback ON hosts;
+ALTER TABLE hosts DROP COLUMN `fallback_unique`;
+ALTER TABLE hosts DROP COLUMN `fallback`
@@ -0,0 +1,23 @@
+ALTER TABLE hosts ADD COLUMN `fallback` BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE hosts ADD COLUMN `fallback_unique` BOOLEAN AS (IF(`fallback`, true, NULL)) STORED;
+CREATE UNIQUE INDEX hosts_fallback ON hosts (`fallback_unique`);
+INSERT INTO hosts (servername, hostname, weight, created, transport, fallback)
+    SELECT 'localhost (fallback)', 'localhost', 0, CURRENT_TIMESTAMP, 'local', true FROM DUAL
+    WHERE NOT EXISTS (SELECT `id` FROM hosts WHERE `fallback`);
+
+UPDATE processes SET `host_id` = (SELECT `id` FROM hosts WHERE `fallback`) WHERE `host_id` = 0;
+DELETE FROM processes WHERE `host_id` IS NULL OR `host_id` NOT IN (SELECT `id` FROM hosts);
+ALTER TABLE processes MODIFY `host_id` INTEGER NOT NULL;
+ALTER TABLE processes ADD CONSTRAINT processes_host_id_fkey
+    FOREIGN KEY (`host_id`) REFERENCES hosts (`id`) ON DELETE CASCADE;
+CREATE INDEX processes_process_id ON processes (`process_id`);
+
+UPDATE states SET `host_id` = (SELECT `id` FROM hosts WHERE `fallback`) WHERE `host_id` = 0;
+DELETE FROM states WHERE `host_id` IS NULL OR `host_id` NOT IN (SELECT `id` FROM hosts);
+ALTER TABLE states MODIFY `host_id` INTEGER NOT NULL;
+ALTER TABLE states ADD CONSTRAINT states_host_id_fkey
+    FOREIGN KEY (`host_id`) REFERENCES hosts (`id`) ON DELETE CASCADE;
+CREATE INDEX states_process_id ON states (`process_id`);
+
+UPDATE jobs SET `host_id` = (SELECT `id` FROM hosts WHERE `fallback`) WHERE `host_id` = 0;
+CREATE INDEX jobs_host_id ON jobs (`host_id`)
@@ -0,0 +1,5 @@
+DROP INDEX processes_instance ON processes;
+DROP INDEX states_instance ON states;
+ALTER TABLE processes DROP COLUMN `instance`;
+ALTER TABLE states DROP COLUMN `instance`;
+ALTER TABLE jobs DROP COLUMN `instance`
@@ -0,0 +1,5 @@
+ALTER TABLE processes ADD COLUMN `instance` VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE states ADD COLUMN `instance` VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE jobs ADD COLUMN `instance` VARCHAR(255) NOT NULL DEFAULT '';
+CREATE INDEX processes_instance ON processes (`instance`, `process_id`);
+CREATE INDEX states_instance ON states (`instance`, `process_id`)
@@ -0,0 +1 @@
+ALTER TABLE hosts ADD COLUMN "transport" TEXT NOT NULL DEFAULT 'ssh'
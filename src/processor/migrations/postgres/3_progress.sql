@@ -0,0 +1,7 @@
+ALTER TABLE processes ADD COLUMN "frame" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE processes ADD COLUMN "fps" DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE processes ADD COLUMN "speed" DOUBLE PRECISION NOT NULL DEFAULT 0;
+ALTER TABLE processes ADD COLUMN "out_time" TEXT NOT NULL DEFAULT '';
+ALTER TABLE processes ADD COLUMN "bitrate" TEXT NOT NULL DEFAULT '';
+ALTER TABLE processes ADD COLUMN "started" TIMESTAMP;
+ALTER TABLE processes ADD COLUMN "updated" TIMESTAMP
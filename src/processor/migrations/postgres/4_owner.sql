@@ -0,0 +1,4 @@
+ALTER TABLE processes ADD COLUMN "boot_id" TEXT NOT NULL DEFAULT '';
+ALTER TABLE processes ADD COLUMN "pid_start" BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE states ADD COLUMN "boot_id" TEXT NOT NULL DEFAULT '';
+ALTER TABLE states ADD COLUMN "pid_start" BIGINT NOT NULL DEFAULT 0
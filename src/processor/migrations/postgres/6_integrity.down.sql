@@ -0,0 +1,18 @@
+ALTER TABLE processes DROP CONSTRAINT IF EXISTS processes_host_id_fkey;
+ALTER TABLE processes ALTER COLUMN "host_id" DROP NOT NULL;
+UPDATE processes SET "host_id" = 0 WHERE "host_id" = (SELECT "id" FROM hosts WHERE "fallback");
+DROP INDEX IF EXISTS processes_host_id;
+DROP INDEX IF EXISTS processes_process_id;
+
+ALTER TABLE states DROP CONSTRAINT IF EXISTS states_host_id_fkey;
+ALTER TABLE states ALTER COLUMN "host_id" DROP NOT NULL;
+UPDATE states SET "host_id" = 0 WHERE "host_id" = (SELECT "id" FROM hosts WHERE "fallback");
+DROP INDEX IF EXISTS states_host_id;
+DROP INDEX IF EXISTS states_process_id;
+
+UPDATE jobs SET "host_id" = 0 WHERE "host_id" = (SELECT "id" FROM hosts WHERE "fallback");
+DROP INDEX IF EXISTS jobs_host_id;
+
+DELETE FROM hosts WHERE "fallback";
+DROP INDEX IF EXISTS hosts_fallback;
+ALTER TABLE hosts DROP COLUMN "fallback"
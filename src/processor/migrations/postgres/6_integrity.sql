@@ -0,0 +1,23 @@
+ALTER TABLE hosts ADD COLUMN "fallback" BOOLEAN NOT NULL DEFAULT false;
+CREATE UNIQUE INDEX IF NOT EXISTS hosts_fallback ON hosts ("fallback") WHERE "fallback";
+INSERT INTO hosts (servername, hostname, weight, created, transport, fallback)
+    VALUES ('localhost (fallback)', 'localhost', 0, CURRENT_TIMESTAMP, 'local', true);
+
+UPDATE processes SET "host_id" = (SELECT "id" FROM hosts WHERE "fallback") WHERE "host_id" = 0;
+DELETE FROM processes WHERE "host_id" IS NULL OR "host_id" NOT IN (SELECT "id" FROM hosts);
+ALTER TABLE processes ALTER COLUMN "host_id" SET NOT NULL;
+ALTER TABLE processes ADD CONSTRAINT processes_host_id_fkey
+    FOREIGN KEY ("host_id") REFERENCES hosts ("id") ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS processes_host_id ON processes ("host_id");
+CREATE INDEX IF NOT EXISTS processes_process_id ON processes ("process_id");
+
+UPDATE states SET "host_id" = (SELECT "id" FROM hosts WHERE "fallback") WHERE "host_id" = 0;
+DELETE FROM states WHERE "host_id" IS NULL OR "host_id" NOT IN (SELECT "id" FROM hosts);
+ALTER TABLE states ALTER COLUMN "host_id" SET NOT NULL;
+ALTER TABLE states ADD CONSTRAINT states_host_id_fkey
+    FOREIGN KEY ("host_id") REFERENCES hosts ("id") ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS states_host_id ON states ("host_id");
+CREATE INDEX IF NOT EXISTS states_process_id ON states ("process_id");
+
+UPDATE jobs SET "host_id" = (SELECT "id" FROM hosts WHERE "fallback") WHERE "host_id" = 0;
+CREATE INDEX IF NOT EXISTS jobs_host_id ON jobs ("host_id")
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS states;
+DROP TABLE IF EXISTS processes;
+DROP TABLE IF EXISTS hosts
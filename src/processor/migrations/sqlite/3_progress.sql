@@ -0,0 +1,7 @@
+ALTER TABLE processes ADD COLUMN "frame" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE processes ADD COLUMN "fps" REAL NOT NULL DEFAULT 0;
+ALTER TABLE processes ADD COLUMN "speed" REAL NOT NULL DEFAULT 0;
+ALTER TABLE processes ADD COLUMN "out_time" TEXT NOT NULL DEFAULT '';
+ALTER TABLE processes ADD COLUMN "bitrate" TEXT NOT NULL DEFAULT '';
+ALTER TABLE processes ADD COLUMN "started" DATETIME;
+ALTER TABLE processes ADD COLUMN "updated" DATETIME
@@ -0,0 +1,4 @@
+ALTER TABLE processes DROP COLUMN "boot_id";
+ALTER TABLE processes DROP COLUMN "pid_start";
+ALTER TABLE states DROP COLUMN "boot_id";
+ALTER TABLE states DROP COLUMN "pid_start"
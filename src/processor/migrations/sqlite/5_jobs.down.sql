@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS jobs_started;
+DROP TABLE IF EXISTS jobs
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS jobs (
+    "id" INTEGER PRIMARY KEY,
+    "host_id" INTEGER NOT NULL,
+    "servername" TEXT NOT NULL,
+    "process_id" INTEGER NOT NULL,
+    "class" TEXT NOT NULL,
+    "cmd" TEXT NOT NULL,
+    "started" DATETIME NOT NULL,
+    "ended" DATETIME NOT NULL,
+    "status" TEXT NOT NULL,
+    "exit_code" INTEGER NOT NULL,
+    "reason" TEXT NOT NULL DEFAULT '',
+    "retries" INTEGER NOT NULL DEFAULT 0,
+    "overhead" INTEGER NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS jobs_started ON jobs ("started")
@@ -0,0 +1,43 @@
+CREATE TABLE processes_old (
+    "id" INTEGER PRIMARY KEY,
+    "host_id" INTEGER,
+    "process_id" INTEGER,
+    "cmd" TEXT,
+    "frame" INTEGER NOT NULL DEFAULT 0,
+    "fps" REAL NOT NULL DEFAULT 0,
+    "speed" REAL NOT NULL DEFAULT 0,
+    "out_time" TEXT NOT NULL DEFAULT '',
+    "bitrate" TEXT NOT NULL DEFAULT '',
+    "started" DATETIME,
+    "updated" DATETIME,
+    "boot_id" TEXT NOT NULL DEFAULT '',
+    "pid_start" INTEGER NOT NULL DEFAULT 0
+);
+INSERT INTO processes_old
+    SELECT "id", CASE WHEN "host_id" = (SELECT "id" FROM hosts WHERE "fallback") THEN 0 ELSE "host_id" END,
+        "process_id", "cmd", "frame", "fps", "speed", "out_time", "bitrate", "started", "updated", "boot_id", "pid_start"
+    FROM processes;
+DROP TABLE processes;
+ALTER TABLE processes_old RENAME TO processes;
+
+CREATE TABLE states_old (
+    "id" INTEGER PRIMARY KEY,
+    "host_id" INTEGER,
+    "process_id" INTEGER,
+    "state" TEXT,
+    "boot_id" TEXT NOT NULL DEFAULT '',
+    "pid_start" INTEGER NOT NULL DEFAULT 0
+);
+INSERT INTO states_old
+    SELECT "id", CASE WHEN "host_id" = (SELECT "id" FROM hosts WHERE "fallback") THEN 0 ELSE "host_id" END,
+        "process_id", "state", "boot_id", "pid_start"
+    FROM states;
+DROP TABLE states;
+ALTER TABLE states_old RENAME TO states;
+
+UPDATE jobs SET "host_id" = 0 WHERE "host_id" = (SELECT "id" FROM hosts WHERE "fallback");
+DROP INDEX IF EXISTS jobs_host_id;
+
+DELETE FROM hosts WHERE "fallback";
+DROP INDEX IF EXISTS hosts_fallback;
+ALTER TABLE hosts DROP COLUMN "fallback"
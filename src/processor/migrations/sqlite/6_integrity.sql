@@ -0,0 +1,48 @@
+ALTER TABLE hosts ADD COLUMN "fallback" BOOLEAN NOT NULL DEFAULT 0;
+CREATE UNIQUE INDEX IF NOT EXISTS hosts_fallback ON hosts ("fallback") WHERE "fallback";
+INSERT INTO hosts (servername, hostname, weight, created, transport, fallback)
+    VALUES ('localhost (fallback)', 'localhost', 0, CURRENT_TIMESTAMP, 'local', 1);
+
+CREATE TABLE processes_new (
+    "id" INTEGER PRIMARY KEY,
+    "host_id" INTEGER NOT NULL REFERENCES hosts ("id") ON DELETE CASCADE,
+    "process_id" INTEGER,
+    "cmd" TEXT,
+    "frame" INTEGER NOT NULL DEFAULT 0,
+    "fps" REAL NOT NULL DEFAULT 0,
+    "speed" REAL NOT NULL DEFAULT 0,
+    "out_time" TEXT NOT NULL DEFAULT '',
+    "bitrate" TEXT NOT NULL DEFAULT '',
+    "started" DATETIME,
+    "updated" DATETIME,
+    "boot_id" TEXT NOT NULL DEFAULT '',
+    "pid_start" INTEGER NOT NULL DEFAULT 0
+);
+INSERT INTO processes_new
+    SELECT "id", CASE WHEN "host_id" = 0 THEN (SELECT "id" FROM hosts WHERE "fallback") ELSE "host_id" END,
+        "process_id", "cmd", "frame", "fps", "speed", "out_time", "bitrate", "started", "updated", "boot_id", "pid_start"
+    FROM processes WHERE "host_id" = 0 OR "host_id" IN (SELECT "id" FROM hosts);
+DROP TABLE processes;
+ALTER TABLE processes_new RENAME TO processes;
+CREATE INDEX IF NOT EXISTS processes_host_id ON processes ("host_id");
+CREATE INDEX IF NOT EXISTS processes_process_id ON processes ("process_id");
+
+CREATE TABLE states_new (
+    "id" INTEGER PRIMARY KEY,
+    "host_id" INTEGER NOT NULL REFERENCES hosts ("id") ON DELETE CASCADE,
+    "process_id" INTEGER,
+    "state" TEXT,
+    "boot_id" TEXT NOT NULL DEFAULT '',
+    "pid_start" INTEGER NOT NULL DEFAULT 0
+);
+INSERT INTO states_new
+    SELECT "id", CASE WHEN "host_id" = 0 THEN (SELECT "id" FROM hosts WHERE "fallback") ELSE "host_id" END,
+        "process_id", "state", "boot_id", "pid_start"
+    FROM states WHERE "host_id" = 0 OR "host_id" IN (SELECT "id" FROM hosts);
+DROP TABLE states;
+ALTER TABLE states_new RENAME TO states;
+CREATE INDEX IF NOT EXISTS states_host_id ON states ("host_id");
+CREATE INDEX IF NOT EXISTS states_process_id ON states ("process_id");
+
+UPDATE jobs SET "host_id" = (SELECT "id" FROM hosts WHERE "fallback") WHERE "host_id" = 0;
+CREATE INDEX IF NOT EXISTS jobs_host_id ON jobs ("host_id")
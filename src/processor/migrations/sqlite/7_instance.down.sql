@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS processes_instance;
+DROP INDEX IF EXISTS states_instance;
+ALTER TABLE processes DROP COLUMN "instance";
+ALTER TABLE states DROP COLUMN "instance";
+ALTER TABLE jobs DROP COLUMN "instance"
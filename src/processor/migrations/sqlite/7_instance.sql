@@ -0,0 +1,5 @@
+ALTER TABLE processes ADD COLUMN "instance" TEXT NOT NULL DEFAULT '';
+ALTER TABLE states ADD COLUMN "instance" TEXT NOT NULL DEFAULT '';
+ALTER TABLE jobs ADD COLUMN "instance" TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS processes_instance ON processes ("instance", "process_id");
+CREATE INDEX IF NOT EXISTS states_instance ON states ("instance", "process_id")
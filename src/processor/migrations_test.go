@@ -0,0 +1,241 @@
+package processor
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/tminaorg/ffmpegof/src/migrate"
+)
+
+// openSqlite opens a fresh database the way the config does, with foreign keys enforced
+func openSqlite(t *testing.T) *sql.DB {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ffmpegof.db")
+	db, err := sql.Open("sqlite", fmt.Sprintf("%s?_pragma=foreign_keys(1)&_txlock=immediate", path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+// openPostgres opens the database of FFMPEGOF_TEST_POSTGRES, whose tables are dropped
+func openPostgres(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("FFMPEGOF_TEST_POSTGRES")
+	if dsn == "" {
+		t.Skip("FFMPEGOF_TEST_POSTGRES isn't set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drop := func() {
+		if _, err := db.Exec(`DROP TABLE IF EXISTS processes, states, jobs, hosts, schema_migration`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	drop()
+	t.Cleanup(func() {
+		drop()
+		db.Close()
+	})
+	return db
+}
+
+// openMysql opens the database of FFMPEGOF_TEST_MYSQL, a dsn like user:password@tcp(host)/name,
+// whose tables are dropped
+func openMysql(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("FFMPEGOF_TEST_MYSQL")
+	if dsn == "" {
+		t.Skip("FFMPEGOF_TEST_MYSQL isn't set")
+	}
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drop := func() {
+		if _, err := db.Exec(`DROP TABLE IF EXISTS processes, states, jobs, hosts, schema_migration`); err != nil {
+			t.Fatal(err)
+		}
+	}
+	drop()
+	t.Cleanup(func() {
+		drop()
+		db.Close()
+	})
+	return db
+}
+
+func exec(t *testing.T, db *sql.DB, query string) {
+	t.Helper()
+	if _, err := db.Exec(query); err != nil {
+		t.Fatalf("%s: %s", query, err)
+	}
+}
+
+func count(t *testing.T, db *sql.DB, query string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query).Scan(&n); err != nil {
+		t.Fatalf("%s: %s", query, err)
+	}
+	return n
+}
+
+// testIntegrity seeds the schema of version 5 with rows of the local fallback, which used
+// host_id 0, and rows of deleted hosts, then migrates to the latest version and back
+func testIntegrity(t *testing.T, db *sql.DB, dbType string) {
+	mg, err := migrate.New(db, dbType, "migrations/"+dbType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(dbType, mg); err != nil {
+		t.Fatal(err)
+	}
+	if err := Rollback(dbType, mg, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	exec(t, db, `INSERT INTO hosts (id, servername, hostname, weight, created, transport) VALUES (10, 'one', 'one', 1, CURRENT_TIMESTAMP, 'ssh')`)
+	exec(t, db, `INSERT INTO hosts (id, servername, hostname, weight, created, transport) VALUES (11, 'two', 'two', 1, CURRENT_TIMESTAMP, 'ssh')`)
+	exec(t, db, `INSERT INTO processes (host_id, process_id, cmd) VALUES (0, 100, 'ffmpeg local')`)
+	exec(t, db, `INSERT INTO processes (host_id, process_id, cmd) VALUES (10, 101, 'ffmpeg one')`)
+	exec(t, db, `INSERT INTO processes (host_id, process_id, cmd) VALUES (11, 102, 'ffmpeg two')`)
+	exec(t, db, `INSERT INTO processes (host_id, process_id, cmd) VALUES (99, 103, 'ffmpeg deleted')`)
+	exec(t, db, `INSERT INTO states (host_id, process_id, state) VALUES (0, 100, 'active')`)
+	exec(t, db, `INSERT INTO states (host_id, process_id, state) VALUES (10, 0, 'bad')`)
+	exec(t, db, `INSERT INTO states (host_id, process_id, state) VALUES (99, 0, 'bad')`)
+	exec(t, db, `INSERT INTO jobs (host_id, servername, process_id, class, cmd, started, ended, status, exit_code, reason)
+		VALUES (0, 'localhost', 100, 'transcode', 'ffmpeg local', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'done', 0, '')`)
+	exec(t, db, `INSERT INTO jobs (host_id, servername, process_id, class, cmd, started, ended, status, exit_code, reason)
+		VALUES (99, 'deleted', 103, 'transcode', 'ffmpeg deleted', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, 'done', 0, '')`)
+
+	if err := Migrate(dbType, mg); err != nil {
+		t.Fatal(err)
+	}
+
+	var fallback int
+	if err := db.QueryRow(`SELECT id FROM hosts WHERE fallback`).Scan(&fallback); err != nil {
+		t.Fatalf("select fallback: %s", err)
+	}
+	if n := count(t, db, fmt.Sprintf(`SELECT COUNT(*) FROM processes WHERE host_id = %d AND process_id = 100`, fallback)); n != 1 {
+		t.Errorf("local process remapped to the fallback: got %d, want 1", n)
+	}
+	if n := count(t, db, fmt.Sprintf(`SELECT COUNT(*) FROM states WHERE host_id = %d AND process_id = 100`, fallback)); n != 1 {
+		t.Errorf("local state remapped to the fallback: got %d, want 1", n)
+	}
+	if n := count(t, db, fmt.Sprintf(`SELECT COUNT(*) FROM jobs WHERE host_id = %d`, fallback)); n != 1 {
+		t.Errorf("local job remapped to the fallback: got %d, want 1", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM processes WHERE host_id = 99`); n != 0 {
+		t.Errorf("processes of deleted hosts: got %d, want 0", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM states WHERE host_id = 99`); n != 0 {
+		t.Errorf("states of deleted hosts: got %d, want 0", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM jobs WHERE host_id = 99`); n != 1 {
+		t.Errorf("history of deleted hosts is kept: got %d, want 1", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM processes`); n != 3 {
+		t.Errorf("processes: got %d, want 3", n)
+	}
+
+	// removing a host takes its processes and states along
+	exec(t, db, `DELETE FROM hosts WHERE id = 10`)
+	if n := count(t, db, `SELECT COUNT(*) FROM processes WHERE host_id = 10`); n != 0 {
+		t.Errorf("processes after deleting their host: got %d, want 0", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM states WHERE host_id = 10`); n != 0 {
+		t.Errorf("states after deleting their host: got %d, want 0", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM processes WHERE host_id = 11`); n != 1 {
+		t.Errorf("processes of other hosts: got %d, want 1", n)
+	}
+
+	// there is only one fallback
+	if _, err := db.Exec(`INSERT INTO hosts (servername, hostname, weight, created, transport, fallback)
+		VALUES ('second fallback', 'localhost', 0, CURRENT_TIMESTAMP, 'local', true)`); err == nil {
+		t.Error("inserted a second fallback")
+	}
+
+	if err := Rollback(dbType, mg, 5); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM processes WHERE host_id = 0 AND process_id = 100`); n != 1 {
+		t.Errorf("local process back on host_id 0: got %d, want 1", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM states WHERE host_id = 0 AND process_id = 100`); n != 1 {
+		t.Errorf("local state back on host_id 0: got %d, want 1", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM jobs WHERE host_id = 0`); n != 1 {
+		t.Errorf("local job back on host_id 0: got %d, want 1", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM hosts`); n != 1 {
+		t.Errorf("hosts without the fallback: got %d, want 1", n)
+	}
+}
+
+func TestIntegritySqlite(t *testing.T) {
+	testIntegrity(t, openSqlite(t), "sqlite")
+}
+
+func TestIntegrityPostgres(t *testing.T) {
+	testIntegrity(t, openPostgres(t), "postgres")
+}
+
+func TestIntegrityMysql(t *testing.T) {
+	testIntegrity(t, openMysql(t), "mysql")
+}
+
+// TestIntegrityMysqlResume applies the integrity migration again after it failed halfway, which
+// mysql can't roll back
+func TestIntegrityMysqlResume(t *testing.T) {
+	db := openMysql(t)
+	mg, err := migrate.New(db, "mysql", "migrations/mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate("mysql", mg); err != nil {
+		t.Fatal(err)
+	}
+	if err := Rollback("mysql", mg, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	exec(t, db, `INSERT INTO processes (host_id, process_id, cmd) VALUES (0, 100, 'ffmpeg local')`)
+	exec(t, db, `ALTER TABLE hosts ADD COLUMN fallback BOOLEAN NOT NULL DEFAULT false`)
+	exec(t, db, `ALTER TABLE hosts ADD COLUMN fallback_unique BOOLEAN AS (IF(fallback, true, NULL)) STORED`)
+	exec(t, db, `CREATE UNIQUE INDEX hosts_fallback ON hosts (fallback_unique)`)
+	exec(t, db, `INSERT INTO hosts (servername, hostname, weight, created, transport, fallback)
+		VALUES ('localhost (fallback)', 'localhost', 0, CURRENT_TIMESTAMP, 'local', true)`)
+	exec(t, db, `UPDATE processes SET host_id = (SELECT id FROM hosts WHERE fallback) WHERE host_id = 0`)
+	exec(t, db, `ALTER TABLE processes MODIFY host_id INTEGER NOT NULL`)
+	exec(t, db, `ALTER TABLE processes ADD CONSTRAINT processes_host_id_fkey
+		FOREIGN KEY (host_id) REFERENCES hosts (id) ON DELETE CASCADE`)
+
+	if err := Migrate("mysql", mg); err != nil {
+		t.Fatalf("migrate again: %s", err)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM hosts WHERE fallback`); n != 1 {
+		t.Errorf("fallback hosts: got %d, want 1", n)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM processes WHERE host_id = (SELECT id FROM hosts WHERE fallback)`); n != 1 {
+		t.Errorf("local process remapped to the fallback: got %d, want 1", n)
+	}
+
+	// reverting halfway can be resumed too
+	exec(t, db, `ALTER TABLE processes DROP FOREIGN KEY processes_host_id_fkey`)
+	if err := Rollback("mysql", mg, 5); err != nil {
+		t.Fatalf("rollback again: %s", err)
+	}
+	if n := count(t, db, `SELECT COUNT(*) FROM processes WHERE host_id = 0`); n != 1 {
+		t.Errorf("local process back on host_id 0: got %d, want 1", n)
+	}
+}
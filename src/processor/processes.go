@@ -11,10 +11,10 @@ import (
 
 func sqlInsertProcess(dbType string) (string, error) {
 	switch dbType {
-	case "sqlite":
-		return `INSERT INTO processes (host_id, process_id, cmd) VALUES (?, ?, ?) `, nil
+	case "sqlite", "mysql":
+		return `INSERT INTO processes (host_id, process_id, cmd, started, updated, boot_id, pid_start, instance) VALUES (?, ?, ?, ?, ?, ?, ?, ?) `, nil
 	case "postgres":
-		return `INSERT INTO processes (host_id, process_id, cmd) VALUES ($1, $2, $3) `, nil
+		return `INSERT INTO processes (host_id, process_id, cmd, started, updated, boot_id, pid_start, instance) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) `, nil
 	default:
 		return "", fmt.Errorf("incorrect database type")
 	}
@@ -31,7 +31,7 @@ func (store *datastore) InsertProcess(process Process) error {
 		return err
 	}
 
-	if _, err = tx.Exec(sqlInsertProcess, process.HostId, process.ProcessId, process.Cmd); err != nil {
+	if _, err = tx.Exec(sqlInsertProcess, process.HostId, process.ProcessId, process.Cmd, process.Started, process.Updated, process.BootId, process.PidStart, process.Instance); err != nil {
 		if rollbackErr := tx.Rollback(); rollbackErr != nil {
 			panic(rollbackErr)
 		}
@@ -41,9 +41,35 @@ func (store *datastore) InsertProcess(process Process) error {
 	return tx.Commit()
 }
 
+func sqlUpdateProcessProgress(dbType string) (string, error) {
+	switch dbType {
+	case "sqlite", "mysql":
+		return `UPDATE processes SET frame=?, fps=?, speed=?, out_time=?, bitrate=?, updated=? WHERE process_id=? AND instance=?`, nil
+	case "postgres":
+		return `UPDATE processes SET frame=$1, fps=$2, speed=$3, out_time=$4, bitrate=$5, updated=$6 WHERE process_id=$7 AND instance=$8`, nil
+	default:
+		return "", fmt.Errorf("incorrect database type")
+	}
+}
+
+func (store *datastore) UpdateProcessProgress(process Process) error {
+	sqlUpdateProcessProgress, err := sqlUpdateProcessProgress(store.dbType)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.Exec(sqlUpdateProcessProgress,
+		process.Frame, process.Fps, process.Speed, process.OutTime, process.Bitrate, process.Updated, process.ProcessId, process.Instance)
+	if err != nil {
+		return fmt.Errorf("update process progress: %w", err)
+	}
+
+	return nil
+}
+
 func sqlDeleteProcesses(dbType string) (string, error) {
 	switch dbType {
-	case "sqlite":
+	case "sqlite", "mysql":
 		return `DELETE FROM processes`, nil
 	case "postgres":
 		return `DELETE FROM processes`, nil
@@ -68,7 +94,7 @@ func (store *datastore) DeleteProcesses() error {
 
 func sqlDeleteProcessesWhere(dbType string) (string, error) {
 	switch dbType {
-	case "sqlite":
+	case "sqlite", "mysql":
 		return `DELETE FROM processes WHERE %s=?`, nil
 	case "postgres":
 		return `DELETE FROM processes WHERE %s=$1`, nil
@@ -90,6 +116,8 @@ func (store *datastore) DeleteProcessesWhere(field string, process Process) erro
 		_, err = store.Exec(sqlDeleteProcessesWhere, process.HostId)
 	} else if field == "process_id" {
 		_, err = store.Exec(sqlDeleteProcessesWhere, process.ProcessId)
+	} else if field == "instance" {
+		_, err = store.Exec(sqlDeleteProcessesWhere, process.Instance)
 	} else {
 		return fmt.Errorf("delete processes where: wrong field name")
 	}
@@ -101,9 +129,34 @@ func (store *datastore) DeleteProcessesWhere(field string, process Process) erro
 	return nil
 }
 
+func sqlDeleteProcessesOfInstance(dbType string) (string, error) {
+	switch dbType {
+	case "sqlite", "mysql":
+		return `DELETE FROM processes WHERE instance=? AND process_id=?`, nil
+	case "postgres":
+		return `DELETE FROM processes WHERE instance=$1 AND process_id=$2`, nil
+	default:
+		return "", fmt.Errorf("incorrect database type")
+	}
+}
+
+// DeleteProcessesOfInstance removes the processes of a PID, leaving the same PID of other instances alone
+func (store *datastore) DeleteProcessesOfInstance(process Process) error {
+	sqlDeleteProcessesOfInstance, err := sqlDeleteProcessesOfInstance(store.dbType)
+	if err != nil {
+		return err
+	}
+
+	if _, err = store.Exec(sqlDeleteProcessesOfInstance, process.Instance, process.ProcessId); err != nil {
+		return fmt.Errorf("delete processes of instance: %w", err)
+	}
+
+	return nil
+}
+
 func sqlSelectCountProcesses(dbType string) (string, error) {
 	switch dbType {
-	case "sqlite":
+	case "sqlite", "mysql":
 		return `SELECT COUNT(id) FROM processes`, nil
 	case "postgres":
 		return `SELECT COUNT(id) FROM processes`, nil
@@ -134,7 +187,7 @@ func (store *datastore) SelectCountProcesses() (int, error) {
 
 func sqlSelectCountProcessesWhere(dbType string) (string, error) {
 	switch dbType {
-	case "sqlite":
+	case "sqlite", "mysql":
 		return `SELECT COUNT(id) FROM processes WHERE host_id=?`, nil
 	case "postgres":
 		return `SELECT COUNT(id) FROM processes WHERE host_id=$1`, nil
@@ -165,7 +218,7 @@ func (store *datastore) SelectCountProcessesWhere(host Host) (int, error) {
 
 func sqlSelectProcesses(dbType string) (string, error) {
 	switch dbType {
-	case "sqlite":
+	case "sqlite", "mysql":
 		return `SELECT %s FROM processes`, nil
 	case "postgres":
 		return `SELECT %s FROM processes`, nil
@@ -189,10 +242,16 @@ func (store *datastore) SelectProcesses() (processes []Process, err error) {
 	defer rows.Close()
 	for rows.Next() {
 		process := Process{}
-		err = rows.Scan(&process.Id, &process.HostId, &process.ProcessId, &process.Cmd)
+		started := sql.NullTime{}
+		updated := sql.NullTime{}
+		err = rows.Scan(&process.Id, &process.HostId, &process.ProcessId, &process.Cmd,
+			&process.Frame, &process.Fps, &process.Speed, &process.OutTime, &process.Bitrate, &started, &updated,
+			&process.BootId, &process.PidStart, &process.Instance)
 		if err != nil {
 			return processes, err
 		}
+		process.Started = started.Time
+		process.Updated = updated.Time
 
 		processes = append(processes, process)
 	}
@@ -228,7 +287,7 @@ func (store *datastore) SelectProcessesId() (processes []Process, err error) {
 
 func sqlSelectProcessesWhere(dbType string) (string, error) {
 	switch dbType {
-	case "sqlite":
+	case "sqlite", "mysql":
 		return `SELECT %s FROM processes WHERE host_id=? ORDER BY id DESC`, nil
 	case "postgres":
 		return `SELECT %s FROM processes WHERE host_id=$1 ORDER BY id DESC`, nil
@@ -252,10 +311,16 @@ func (store *datastore) SelectProcessesWhere(host Host) (processes []Process, er
 	defer rows.Close()
 	for rows.Next() {
 		process := Process{}
-		err = rows.Scan(&process.Id, &process.HostId, &process.ProcessId, &process.Cmd)
+		started := sql.NullTime{}
+		updated := sql.NullTime{}
+		err = rows.Scan(&process.Id, &process.HostId, &process.ProcessId, &process.Cmd,
+			&process.Frame, &process.Fps, &process.Speed, &process.OutTime, &process.Bitrate, &started, &updated,
+			&process.BootId, &process.PidStart, &process.Instance)
 		if err != nil {
 			return processes, err
 		}
+		process.Started = started.Time
+		process.Updated = updated.Time
 
 		processes = append(processes, process)
 	}
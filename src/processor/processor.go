@@ -11,6 +11,10 @@ type Config struct {
 	Db     *sql.DB
 	DbType string
 	Mg     *migrate.Migrator
+	// Store is used as is when set, instead of the datastore of the database type
+	Store Store
+	// Retry of the statements failing on a transient error, the zero value never retries
+	Retry Retry
 }
 
 type Host struct {
@@ -19,6 +23,8 @@ type Host struct {
 	Hostname   string
 	Weight     int
 	Created    time.Time
+	Transport  string
+	Fallback   bool
 }
 
 type Process struct {
@@ -26,6 +32,21 @@ type Process struct {
 	HostId    int
 	ProcessId int
 	Cmd       string
+
+	// progress as last reported by ffmpeg
+	Frame   int
+	Fps     float64
+	Speed   float64
+	OutTime string
+	Bitrate string
+	Started time.Time
+	Updated time.Time
+
+	// identity of the owner, so rows of dead processes can be told apart from reused PIDs
+	BootId   string
+	PidStart int64
+	// media server instance owning the row, PIDs are only unique within it
+	Instance string
 }
 
 type State struct {
@@ -33,129 +54,288 @@ type State struct {
 	HostId    int
 	ProcessId int
 	State     string
+	BootId    string
+	PidStart  int64
+	Instance  string
+}
+
+// Job is the record of a finished job
+type Job struct {
+	Id         int
+	HostId     int
+	Servername string
+	ProcessId  int
+	Class      string
+	Cmd        string
+	Started    time.Time
+	Ended      time.Time
+	Status     string
+	ExitCode   int
+	Reason     string
+	Retries    int
+	Overhead   time.Duration
+	Instance   string
+}
+
+// JobFilter selects jobs from the history, zero values match everything
+type JobFilter struct {
+	Servername string
+	Since      time.Time
+	Until      time.Time
+	Status     string
+	Class      string
+	Limit      int
 }
 
 func New(config Config) (*Processor, error) {
-	store, err := newDatastore(config.Db, config.DbType, config.Mg)
-	if err != nil {
-		return nil, err
+	store := config.Store
+	if store == nil && config.DbType == "memory" {
+		store = NewMemoryStore()
+	}
+	if store == nil {
+		datastore, err := newDatastore(config.Db, config.DbType, config.Mg)
+		if err != nil {
+			return nil, err
+		}
+		store = datastore
 	}
 
 	proc := &Processor{
 		store: store,
+		retry: config.Retry,
 	}
 	return proc, nil
 }
 
 type Processor struct {
-	store *datastore
+	store Store
+	retry Retry
 	// processed int64
 }
 
 // version
 func (p *Processor) GetVersion() (string, error) {
-	return p.store.SelectVersion()
+	return retry(p, func() (string, error) {
+		return p.store.SelectVersion()
+	})
+}
+
+// Transaction runs fn on a processor whose changes are only kept if fn succeeds. A transaction
+// failing on a transient error is retried as a whole, the statements within it never are. One
+// whose connection got lost isn't, as it may have been committed.
+func (p *Processor) Transaction(fn func(proc *Processor) error) error {
+	return p.retry.doOnce(func() error {
+		return p.store.Transaction(func(store Store) error {
+			return fn(&Processor{store: store})
+		})
+	})
 }
 
 // hosts
 func (p *Processor) AddHost(host Host) error {
-	return p.store.UpsertHost(host)
+	return p.retry.do(func() error {
+		return p.store.UpsertHost(host)
+	})
+}
+
+// UpdateHost changes the name, hostname, weight and transport of the host with the same id
+func (p *Processor) UpdateHost(host Host) error {
+	return p.retry.do(func() error {
+		return p.store.UpdateHost(host)
+	})
 }
 
 func (p *Processor) RemoveHosts() error {
-	return p.store.DeleteHosts()
+	return p.retry.do(func() error {
+		return p.store.DeleteHosts()
+	})
 }
 
 func (p *Processor) RemoveHost(host Host) error {
-	return p.store.DeleteHost(host)
+	return p.retry.do(func() error {
+		return p.store.DeleteHost(host)
+	})
 }
 
 func (p *Processor) NumberOfHosts() (int, error) {
-	return p.store.SelectCountHosts()
+	return retry(p, func() (int, error) {
+		return p.store.SelectCountHosts()
+	})
 }
 
 func (p *Processor) GetHosts() ([]Host, error) {
-	return p.store.SelectHosts()
+	return retry(p, func() ([]Host, error) {
+		return p.store.SelectHosts()
+	})
+}
+
+func (p *Processor) GetFallbackHost() (Host, error) {
+	return retry(p, func() (Host, error) {
+		return p.store.SelectFallbackHost()
+	})
 }
 
 func (p *Processor) GetHostsByField(field string, value string) ([]Host, error) {
-	return p.store.SelectHostsWhere(field, value)
+	return retry(p, func() ([]Host, error) {
+		return p.store.SelectHostsWhere(field, value)
+	})
 }
 
 func (p *Processor) GetHostsIdByField(field string, value string) ([]Host, error) {
-	return p.store.SelectHostsIdWhere(field, value)
+	return retry(p, func() ([]Host, error) {
+		return p.store.SelectHostsIdWhere(field, value)
+	})
 }
 
 // processes
 func (p *Processor) AddProcess(process Process) error {
-	return p.store.InsertProcess(process)
+	return p.retry.doOnce(func() error {
+		return p.store.InsertProcess(process)
+	})
+}
+
+func (p *Processor) UpdateProcessProgress(process Process) error {
+	return p.retry.do(func() error {
+		return p.store.UpdateProcessProgress(process)
+	})
 }
 
 func (p *Processor) RemoveProcesses() error {
-	return p.store.DeleteProcesses()
+	return p.retry.do(func() error {
+		return p.store.DeleteProcesses()
+	})
 }
 
 func (p *Processor) RemoveProcessesByField(field string, process Process) error {
-	return p.store.DeleteProcessesWhere(field, process)
+	return p.retry.do(func() error {
+		return p.store.DeleteProcessesWhere(field, process)
+	})
+}
+
+func (p *Processor) RemoveProcessesOfInstance(process Process) error {
+	return p.retry.do(func() error {
+		return p.store.DeleteProcessesOfInstance(process)
+	})
 }
 
 func (p *Processor) NumberOfProcesses() (int, error) {
-	return p.store.SelectCountProcesses()
+	return retry(p, func() (int, error) {
+		return p.store.SelectCountProcesses()
+	})
 }
 
 func (p *Processor) NumberOfProcessesFromHost(host Host) (int, error) {
-	return p.store.SelectCountProcessesWhere(host)
+	return retry(p, func() (int, error) {
+		return p.store.SelectCountProcessesWhere(host)
+	})
 }
 
 func (p *Processor) GetProcesses() ([]Process, error) {
-	return p.store.SelectProcesses()
+	return retry(p, func() ([]Process, error) {
+		return p.store.SelectProcesses()
+	})
 }
 
 func (p *Processor) GetProcessesId() ([]Process, error) {
-	return p.store.SelectProcessesId()
+	return retry(p, func() ([]Process, error) {
+		return p.store.SelectProcessesId()
+	})
 }
 
 func (p *Processor) GetProcessesFromHost(host Host) ([]Process, error) {
-	return p.store.SelectProcessesWhere(host)
+	return retry(p, func() ([]Process, error) {
+		return p.store.SelectProcessesWhere(host)
+	})
 }
 
 func (p *Processor) GetProcessesIdFromHost(host Host) ([]Process, error) {
-	return p.store.SelectProcessesIdWhere(host)
+	return retry(p, func() ([]Process, error) {
+		return p.store.SelectProcessesIdWhere(host)
+	})
 }
 
 // states
 func (p *Processor) AddState(state State) error {
-	return p.store.InsertState(state)
+	return p.retry.doOnce(func() error {
+		return p.store.InsertState(state)
+	})
 }
 
 func (p *Processor) RemoveStates() error {
-	return p.store.DeleteStates()
+	return p.retry.do(func() error {
+		return p.store.DeleteStates()
+	})
 }
 
 func (p *Processor) RemoveStatesByField(field string, state State) error {
-	return p.store.DeleteStatesWhere(field, state)
+	return p.retry.do(func() error {
+		return p.store.DeleteStatesWhere(field, state)
+	})
+}
+
+func (p *Processor) RemoveStatesOfInstance(state State) error {
+	return p.retry.do(func() error {
+		return p.store.DeleteStatesOfInstance(state)
+	})
 }
 
 func (p *Processor) NumberOfStates() (int, error) {
-	return p.store.SelectCountStates()
+	return retry(p, func() (int, error) {
+		return p.store.SelectCountStates()
+	})
 }
 
 func (p *Processor) NumberOfStatesFromHost(host Host) (int, error) {
-	return p.store.SelectCountStatesWhere(host)
+	return retry(p, func() (int, error) {
+		return p.store.SelectCountStatesWhere(host)
+	})
 }
 
 func (p *Processor) GetStates() ([]State, error) {
-	return p.store.SelectStates()
+	return retry(p, func() ([]State, error) {
+		return p.store.SelectStates()
+	})
 }
 
 func (p *Processor) GetStatesId() ([]State, error) {
-	return p.store.SelectStatesId()
+	return retry(p, func() ([]State, error) {
+		return p.store.SelectStatesId()
+	})
 }
 
 func (p *Processor) GetStatesFromHost(host Host) ([]State, error) {
-	return p.store.SelectStatesWhere(host)
+	return retry(p, func() ([]State, error) {
+		return p.store.SelectStatesWhere(host)
+	})
 }
 
 func (p *Processor) GetStatesIdFromHost(host Host) ([]State, error) {
-	return p.store.SelectStatesIdWhere(host)
+	return retry(p, func() ([]State, error) {
+		return p.store.SelectStatesIdWhere(host)
+	})
+}
+
+// jobs
+func (p *Processor) AddJob(job Job) error {
+	return p.retry.doOnce(func() error {
+		return p.store.InsertJob(job)
+	})
+}
+
+func (p *Processor) RemoveJobs() error {
+	return p.retry.do(func() error {
+		return p.store.DeleteJobs()
+	})
+}
+
+func (p *Processor) RemoveJobsBefore(before time.Time) error {
+	return p.retry.do(func() error {
+		return p.store.DeleteJobsBefore(before)
+	})
+}
+
+func (p *Processor) GetJobs(filter JobFilter) ([]Job, error) {
+	return retry(p, func() ([]Job, error) {
+		return p.store.SelectJobsWhere(filter)
+	})
 }
@@ -0,0 +1,141 @@
+package processor
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"syscall"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/rs/zerolog/log"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// Retry sets how often statements failing on a transient error are retried
+type Retry struct {
+	// Attempts made at most, 1 never retries
+	Attempts int
+	// Backoff before the first retry, doubled on every other one
+	Backoff time.Duration
+	// MaxBackoff caps the doubling
+	MaxBackoff time.Duration
+}
+
+// transient tells errors of statements that certainly weren't applied and are worth retrying,
+// locks held by other connections and connections that couldn't be used, from the ones that
+// fail again anyway
+func transient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		// extended result codes keep the primary one in the lowest byte
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+			return true
+		}
+		return false
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code.Class() {
+		// transaction rollback: serialization_failure, deadlock_detected
+		case "40":
+			return true
+		}
+		switch pqErr.Code {
+		// lock_not_available, too_many_connections, cannot_connect_now,
+		// sqlclient_unable_to_establish_sqlconnection, sqlserver_rejected_establishment_of_sqlconnection
+		case "55P03", "53300", "57P03", "08001", "08004":
+			return true
+		}
+		return false
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		switch mysqlErr.Number {
+		// too many connections, lock wait timeout, deadlock
+		case 1040, 1205, 1213:
+			return true
+		}
+		return false
+	}
+
+	// database/sql only hands out bad connections before anything was sent on them
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// lost tells errors of connections lost while a statement ran, which may have been applied
+// before the answer got lost
+func lost(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		// connection exception, admin_shutdown
+		return pqErr.Code.Class() == "08" || pqErr.Code == "57P01"
+	}
+
+	return errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
+
+// backoff is the delay before the retry following the attempt, with full jitter so the
+// wrappers started by one library scan don't all retry at the same time
+func (r Retry) backoff(attempt int) time.Duration {
+	delay := r.Backoff << (attempt - 1)
+	if delay <= 0 || (r.MaxBackoff > 0 && delay > r.MaxBackoff) {
+		delay = r.MaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay)) + 1)
+}
+
+// do runs a statement that can be applied twice, like a read, an update or a delete, until it
+// succeeds, fails on an error that isn't worth retrying or runs out of attempts
+func (r Retry) do(fn func() error) error {
+	return r.run(fn, func(err error) bool {
+		return transient(err) || lost(err)
+	})
+}
+
+// doOnce runs a statement that mustn't be applied twice, like an insert, which is only retried
+// when it certainly failed before being applied
+func (r Retry) doOnce(fn func() error) error {
+	return r.run(fn, transient)
+}
+
+func (r Retry) run(fn func() error, retryable func(err error) bool) error {
+	err := fn()
+	for attempt := 1; attempt < r.Attempts && retryable(err); attempt++ {
+		delay := r.backoff(attempt)
+		log.Debug().Err(err).Msgf("transient database error, retrying in %v (attempt %d/%d)", delay, attempt+1, r.Attempts)
+		time.Sleep(delay)
+		err = fn()
+	}
+	return err
+}
+
+// retry runs fn with the retry settings of the processor, returning its value
+func retry[T any](p *Processor, fn func() (T, error)) (value T, err error) {
+	err = p.retry.do(func() error {
+		value, err = fn()
+		return err
+	})
+	return value, err
+}
@@ -0,0 +1,144 @@
+package processor
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// busyError returns the error of a write to a sqlite database another connection holds locked
+func busyError(t *testing.T) error {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "busy.db")
+	open := func() *sql.DB {
+		db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(0)&_txlock=immediate")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			db.Close()
+		})
+		return db
+	}
+
+	holder := open()
+	if _, err := holder.Exec(`CREATE TABLE t (id INTEGER)`); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := holder.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	_, err = open().Exec(`INSERT INTO t (id) VALUES (1)`)
+	if err == nil {
+		t.Fatal("write to a locked database succeeded")
+	}
+	return err
+}
+
+func TestTransient(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+		lost      bool
+	}{
+		{"none", nil, false, false},
+		{"sqlite busy", busyError(t), true, false},
+		{"postgres serialization failure", &pq.Error{Code: "40001"}, true, false},
+		{"postgres deadlock", fmt.Errorf("insert: %w", &pq.Error{Code: "40P01"}), true, false},
+		{"postgres lock not available", &pq.Error{Code: "55P03"}, true, false},
+		{"postgres unable to connect", &pq.Error{Code: "08001"}, true, true},
+		{"postgres connection failure", &pq.Error{Code: "08006"}, false, true},
+		{"postgres admin shutdown", &pq.Error{Code: "57P01"}, false, true},
+		{"postgres unique violation", &pq.Error{Code: "23505"}, false, false},
+		{"mysql deadlock", &mysql.MySQLError{Number: 1213}, true, false},
+		{"mysql lock wait timeout", &mysql.MySQLError{Number: 1205}, true, false},
+		{"mysql duplicate entry", &mysql.MySQLError{Number: 1062}, false, false},
+		{"mysql invalid connection", mysql.ErrInvalidConn, false, true},
+		{"bad connection", fmt.Errorf("query: %w", driver.ErrBadConn), true, false},
+		{"connection refused", fmt.Errorf("dial: %w", syscall.ECONNREFUSED), true, false},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), false, true},
+		{"broken pipe", syscall.EPIPE, false, true},
+		{"unexpected eof", io.ErrUnexpectedEOF, false, true},
+		{"other", errors.New("syntax error"), false, false},
+	}
+
+	for _, test := range tests {
+		if got := transient(test.err); got != test.transient {
+			t.Errorf("%s: transient got %t, want %t", test.name, got, test.transient)
+		}
+		if got := lost(test.err); got != test.lost {
+			t.Errorf("%s: lost got %t, want %t", test.name, got, test.lost)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		retry   Retry
+		attempt int
+		max     time.Duration
+	}{
+		{"first", Retry{Backoff: 50 * time.Millisecond, MaxBackoff: time.Second}, 1, 50 * time.Millisecond},
+		{"doubled", Retry{Backoff: 50 * time.Millisecond, MaxBackoff: time.Second}, 3, 200 * time.Millisecond},
+		{"capped", Retry{Backoff: 50 * time.Millisecond, MaxBackoff: time.Second}, 10, time.Second},
+		{"overflow", Retry{Backoff: 50 * time.Millisecond, MaxBackoff: time.Second}, 80, time.Second},
+		{"uncapped", Retry{Backoff: 50 * time.Millisecond}, 4, 400 * time.Millisecond},
+		{"disabled", Retry{}, 1, 0},
+	}
+
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			delay := test.retry.backoff(test.attempt)
+			if delay > test.max || delay < 0 || (test.max > 0 && delay == 0) {
+				t.Errorf("%s: got %v, want within (0, %v]", test.name, delay, test.max)
+				break
+			}
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	retry := Retry{Attempts: 3}
+	tests := []struct {
+		name  string
+		err   error
+		do    int
+		once  int
+		fails bool
+	}{
+		{"success", nil, 1, 1, false},
+		{"lock", &mysql.MySQLError{Number: 1213}, 3, 3, true},
+		{"lost connection", io.ErrUnexpectedEOF, 3, 1, true},
+		{"other", errors.New("syntax error"), 1, 1, true},
+	}
+
+	for _, test := range tests {
+		calls := 0
+		fn := func() error {
+			calls++
+			return test.err
+		}
+
+		if err := retry.do(fn); (err != nil) != test.fails || calls != test.do {
+			t.Errorf("%s: do made %d calls and returned %v, want %d calls", test.name, calls, err, test.do)
+		}
+		calls = 0
+		if err := retry.doOnce(fn); (err != nil) != test.fails || calls != test.once {
+			t.Errorf("%s: doOnce made %d calls and returned %v, want %d calls", test.name, calls, err, test.once)
+		}
+	}
+}
@@ -11,10 +11,10 @@ import (
 
 func sqlInsertState(dbType string) (string, error) {
 	switch dbType {
-	case "sqlite":
-		return `INSERT INTO states (host_id, process_id, state) VALUES (?, ?, ?) `, nil
+	case "sqlite", "mysql":
+		return `INSERT INTO states (host_id, process_id, state, boot_id, pid_start, instance) VALUES (?, ?, ?, ?, ?, ?) `, nil
 	case "postgres":
-		return `INSERT INTO states (host_id, process_id, state) VALUES ($1, $2, $3) `, nil
+		return `INSERT INTO states (host_id, process_id, state, boot_id, pid_start, instance) VALUES ($1, $2, $3, $4, $5, $6) `, nil
 	default:
 		return "", fmt.Errorf("incorrect database type")
 	}
@@ -31,7 +31,7 @@ func (store *datastore) InsertState(state State) error {
 		return err
 	}
 
-	if _, err = tx.Exec(sqlInsertState, state.HostId, state.ProcessId, state.State); err != nil {
+	if _, err = tx.Exec(sqlInsertState, state.HostId, state.ProcessId, state.State, state.BootId, state.PidStart, state.Instance); err != nil {
 		if rollbackErr := tx.Rollback(); rollbackErr != nil {
 			panic(rollbackErr)
 		}
@@ -43,7 +43,7 @@ func (store *datastore) InsertState(state State) error {
 
 func sqlDeleteStates(dbType string) (string, error) {
 	switch dbType {
-	case "sqlite":
+	case "sqlite", "mysql":
 		return `DELETE FROM states`, nil
 	case "postgres":
 		return `DELETE FROM states`, nil
@@ -68,7 +68,7 @@ func (store *datastore) DeleteStates() error {
 
 func sqlDeleteStatesWhere(dbType string) (string, error) {
 	switch dbType {
-	case "sqlite":
+	case "sqlite", "mysql":
 		return `DELETE FROM states WHERE %s=?`, nil
 	case "postgres":
 		return `DELETE FROM states WHERE %s=$1`, nil
@@ -90,6 +90,8 @@ func (store *datastore) DeleteStatesWhere(field string, state State) error {
 		_, err = store.Exec(sqlDeleteStatesWhere, state.HostId)
 	} else if field == "process_id" {
 		_, err = store.Exec(sqlDeleteStatesWhere, state.ProcessId)
+	} else if field == "instance" {
+		_, err = store.Exec(sqlDeleteStatesWhere, state.Instance)
 	} else {
 		return fmt.Errorf("delete processes where: wrong field name")
 	}
@@ -101,9 +103,34 @@ func (store *datastore) DeleteStatesWhere(field string, state State) error {
 	return nil
 }
 
+func sqlDeleteStatesOfInstance(dbType string) (string, error) {
+	switch dbType {
+	case "sqlite", "mysql":
+		return `DELETE FROM states WHERE instance=? AND process_id=?`, nil
+	case "postgres":
+		return `DELETE FROM states WHERE instance=$1 AND process_id=$2`, nil
+	default:
+		return "", fmt.Errorf("incorrect database type")
+	}
+}
+
+// DeleteStatesOfInstance removes the states of a PID, leaving the same PID of other instances alone
+func (store *datastore) DeleteStatesOfInstance(state State) error {
+	sqlDeleteStatesOfInstance, err := sqlDeleteStatesOfInstance(store.dbType)
+	if err != nil {
+		return err
+	}
+
+	if _, err = store.Exec(sqlDeleteStatesOfInstance, state.Instance, state.ProcessId); err != nil {
+		return fmt.Errorf("delete states of instance: %w", err)
+	}
+
+	return nil
+}
+
 func sqlSelectCountStates(dbType string) (string, error) {
 	switch dbType {
-	case "sqlite":
+	case "sqlite", "mysql":
 		return `SELECT COUNT(id) FROM states`, nil
 	case "postgres":
 		return `SELECT COUNT(id) FROM states`, nil
@@ -134,7 +161,7 @@ func (store *datastore) SelectCountStates() (int, error) {
 
 func sqlSelectCountStatesWhere(dbType string) (string, error) {
 	switch dbType {
-	case "sqlite":
+	case "sqlite", "mysql":
 		return `SELECT COUNT(id) FROM states WHERE host_id=?`, nil
 	case "postgres":
 		return `SELECT COUNT(id) FROM states WHERE host_id=$1`, nil
@@ -165,7 +192,7 @@ func (store *datastore) SelectCountStatesWhere(host Host) (int, error) {
 
 func sqlSelectStates(dbType string) (string, error) {
 	switch dbType {
-	case "sqlite":
+	case "sqlite", "mysql":
 		return `SELECT %s FROM states`, nil
 	case "postgres":
 		return `SELECT %s FROM states`, nil
@@ -189,7 +216,7 @@ func (store *datastore) SelectStates() (states []State, err error) {
 	defer rows.Close()
 	for rows.Next() {
 		state := State{}
-		err = rows.Scan(&state.Id, &state.HostId, &state.ProcessId, &state.State)
+		err = rows.Scan(&state.Id, &state.HostId, &state.ProcessId, &state.State, &state.BootId, &state.PidStart, &state.Instance)
 		if err != nil {
 			return states, err
 		}
@@ -228,7 +255,7 @@ func (store *datastore) SelectStatesId() (states []State, err error) {
 
 func sqlSelectStatesWhere(dbType string) (string, error) {
 	switch dbType {
-	case "sqlite":
+	case "sqlite", "mysql":
 		return `SELECT %s FROM states WHERE host_id=? ORDER BY id DESC`, nil
 	case "postgres":
 		return `SELECT %s FROM states WHERE host_id=$1 ORDER BY id DESC`, nil
@@ -252,7 +279,7 @@ func (store *datastore) SelectStatesWhere(host Host) (states []State, err error)
 	defer rows.Close()
 	for rows.Next() {
 		state := State{}
-		err = rows.Scan(&state.Id, &state.HostId, &state.ProcessId, &state.State)
+		err = rows.Scan(&state.Id, &state.HostId, &state.ProcessId, &state.State, &state.BootId, &state.PidStart, &state.Instance)
 		if err != nil {
 			return states, err
 		}
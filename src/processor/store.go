@@ -0,0 +1,63 @@
+package processor
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrHostNotFound is returned when changing a host that doesn't exist, or the fallback
+var ErrHostNotFound = errors.New("host not found")
+
+// Store is the storage behind the processor, implemented by the SQL datastore and the in-memory store
+type Store interface {
+	SelectVersion() (string, error)
+	// Transaction runs fn on a store whose changes are only kept if fn succeeds
+	Transaction(fn func(store Store) error) error
+
+	// hosts
+	UpsertHost(host Host) error
+	UpdateHost(host Host) error
+	DeleteHosts() error
+	DeleteHost(host Host) error
+	SelectCountHosts() (int, error)
+	SelectHosts() ([]Host, error)
+	SelectFallbackHost() (Host, error)
+	SelectHostsWhere(field string, value string) ([]Host, error)
+	SelectHostsIdWhere(field string, value string) ([]Host, error)
+
+	// processes
+	InsertProcess(process Process) error
+	UpdateProcessProgress(process Process) error
+	DeleteProcesses() error
+	DeleteProcessesWhere(field string, process Process) error
+	DeleteProcessesOfInstance(process Process) error
+	SelectCountProcesses() (int, error)
+	SelectCountProcessesWhere(host Host) (int, error)
+	SelectProcesses() ([]Process, error)
+	SelectProcessesId() ([]Process, error)
+	SelectProcessesWhere(host Host) ([]Process, error)
+	SelectProcessesIdWhere(host Host) ([]Process, error)
+
+	// states
+	InsertState(state State) error
+	DeleteStates() error
+	DeleteStatesWhere(field string, state State) error
+	DeleteStatesOfInstance(state State) error
+	SelectCountStates() (int, error)
+	SelectCountStatesWhere(host Host) (int, error)
+	SelectStates() ([]State, error)
+	SelectStatesId() ([]State, error)
+	SelectStatesWhere(host Host) ([]State, error)
+	SelectStatesIdWhere(host Host) ([]State, error)
+
+	// jobs
+	InsertJob(job Job) error
+	DeleteJobs() error
+	DeleteJobsBefore(before time.Time) error
+	SelectJobsWhere(filter JobFilter) ([]Job, error)
+}
+
+var (
+	_ Store = (*datastore)(nil)
+	_ Store = (*memoryStore)(nil)
+)
@@ -0,0 +1,38 @@
+package reaper
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// bootId changes with every boot of the kernel, so PIDs recorded before a reboot are never trusted
+func bootId() string {
+	data, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// pidStart returns when the process started in clock ticks since boot, which tells a reused PID apart
+func pidStart(pid int) (int64, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, err
+	}
+
+	// the command name in parentheses may contain spaces, the fields after it don't
+	stat := string(data)
+	end := strings.LastIndexByte(stat, ')')
+	if end < 0 {
+		return 0, fmt.Errorf("malformed stat of pid %d", pid)
+	}
+	fields := strings.Fields(stat[end+1:])
+	// starttime is the 22nd field, the fields after the name start at the 3rd
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("malformed stat of pid %d", pid)
+	}
+	return strconv.ParseInt(fields[19], 10, 64)
+}
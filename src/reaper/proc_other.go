@@ -0,0 +1,15 @@
+//go:build !linux
+
+package reaper
+
+import "errors"
+
+// without /proc there is no reliable way to tell whether a PID still belongs to its owner,
+// so rows are never considered stale
+func bootId() string {
+	return ""
+}
+
+func pidStart(pid int) (int64, error) {
+	return 0, errors.New("unsupported platform")
+}
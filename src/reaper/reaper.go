@@ -0,0 +1,108 @@
+package reaper
+
+import (
+	"os"
+	"strings"
+
+	"github.com/tminaorg/ffmpegof/src/processor"
+)
+
+// Self returns the identity recorded on the rows of this process
+func Self(pid int) (string, int64) {
+	start, err := pidStart(pid)
+	if err != nil {
+		return bootId(), 0
+	}
+	return bootId(), start
+}
+
+// Instance identifies the media server this process belongs to when none is configured. The
+// hostname tells containers sharing a kernel apart, the boot ID machines sharing a hostname.
+func Instance(bootId string) string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "localhost"
+	}
+	if bootId == "" {
+		return hostname
+	}
+	return hostname + "@" + bootId
+}
+
+// owned reports whether the liveness of a row's owner can be checked from this instance: rows
+// of other instances live in another PID namespace. Rows from before instances were recorded
+// and rows left by an earlier boot of the same host are checked too.
+func owned(row string, instance string) bool {
+	if row == "" || row == instance {
+		return true
+	}
+	rowHost, _, rowDerived := strings.Cut(row, "@")
+	host, _, derived := strings.Cut(instance, "@")
+	return rowDerived && derived && rowHost == host
+}
+
+// Alive reports whether the process owning a row still runs. Rows without an owner, like
+// suspect states, and rows on platforms without /proc are always alive.
+func Alive(pid int, owner string, start int64) bool {
+	current := bootId()
+	if pid <= 0 || current == "" {
+		return true
+	}
+
+	// rows from before the last boot can't have a live owner
+	if owner != "" && owner != current {
+		return false
+	}
+
+	running, err := pidStart(pid)
+	if err != nil {
+		return false
+	}
+	// the PID was reused by another process
+	return start == 0 || running == start
+}
+
+// Report lists the rows removed by Prune
+type Report struct {
+	Processes []processor.Process
+	States    []processor.State
+}
+
+// Prune removes the processes and states of the instance whose owner is gone, e.g. after the
+// wrapper was killed or its container restarted
+func Prune(proc *processor.Processor, instance string) (Report, error) {
+	report := Report{
+		Processes: make([]processor.Process, 0),
+		States:    make([]processor.State, 0),
+	}
+
+	processes, err := proc.GetProcesses()
+	if err != nil {
+		return report, err
+	}
+	for _, process := range processes {
+		if !owned(process.Instance, instance) || Alive(process.ProcessId, process.BootId, process.PidStart) {
+			continue
+		}
+		if err := proc.RemoveProcessesByField("id", processor.Process{Id: process.Id}); err != nil {
+			return report, err
+		}
+		report.Processes = append(report.Processes, process)
+	}
+
+	states, err := proc.GetStates()
+	if err != nil {
+		return report, err
+	}
+	for _, state := range states {
+		if !owned(state.Instance, instance) || Alive(state.ProcessId, state.BootId, state.PidStart) {
+			continue
+		}
+		if err := proc.RemoveStatesByField("id", processor.State{Id: state.Id}); err != nil {
+			return report, err
+		}
+		report.States = append(report.States, state)
+	}
+
+	return report, nil
+}
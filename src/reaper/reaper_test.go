@@ -0,0 +1,74 @@
+package reaper
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestOwned(t *testing.T) {
+	tests := []struct {
+		name     string
+		row      string
+		instance string
+		want     bool
+	}{
+		{"row from before instances", "", "media@boot1", true},
+		{"row from before instances, configured instance", "", "jellyfin", true},
+		{"same instance", "media@boot1", "media@boot1", true},
+		{"same host, earlier boot", "media@boot0", "media@boot1", true},
+		{"other host", "other@boot0", "media@boot1", false},
+		{"other container on the same kernel", "other@boot1", "media@boot1", false},
+		{"same configured instance", "jellyfin", "jellyfin", true},
+		{"other configured instance", "emby", "jellyfin", false},
+		{"derived row, configured instance", "jellyfin@boot1", "jellyfin", false},
+		{"configured row, derived instance", "media", "media@boot1", false},
+	}
+
+	for _, test := range tests {
+		if got := owned(test.row, test.instance); got != test.want {
+			t.Errorf("%s: owned(%q, %q) got %t, want %t", test.name, test.row, test.instance, got, test.want)
+		}
+	}
+}
+
+func TestAlive(t *testing.T) {
+	current := bootId()
+	if current == "" {
+		t.Skip("no boot id on this platform")
+	}
+
+	pid := os.Getpid()
+	owner, start := Self(pid)
+	if start == 0 {
+		t.Fatal("no start time of this process")
+	}
+
+	// a process that already exited
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	exited := cmd.Process.Pid
+
+	tests := []struct {
+		name  string
+		pid   int
+		owner string
+		start int64
+		want  bool
+	}{
+		{"running", pid, owner, start, true},
+		{"running, recorded before start times", pid, owner, 0, true},
+		{"reused pid", pid, owner, start + 1, false},
+		{"earlier boot", pid, "not-" + current, start, false},
+		{"exited", exited, owner, start, false},
+		{"row without an owner", 0, "", 0, true},
+	}
+
+	for _, test := range tests {
+		if got := Alive(test.pid, test.owner, test.start); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+}
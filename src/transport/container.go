@@ -0,0 +1,26 @@
+package transport
+
+// containerTransport runs commands inside a container on this machine
+// using either docker or podman, which share the same exec interface
+type containerTransport struct {
+	name    string
+	command string
+	tty     bool
+}
+
+func (t *containerTransport) Name() string {
+	return t.name
+}
+
+func (t *containerTransport) Command(target string, command []string) []string {
+	containerCommand := []string{t.command, "exec", "-i"}
+	if t.tty {
+		containerCommand = append(containerCommand, "-t")
+	}
+	containerCommand = append(containerCommand, target)
+	return append(containerCommand, command...)
+}
+
+func (t *containerTransport) Start(target string, command []string, stdio Stdio) (Process, error) {
+	return startCommand(t.Command(target, command), stdio)
+}
@@ -0,0 +1,31 @@
+package transport
+
+import "strings"
+
+type kubectlTransport struct {
+	command string
+	tty     bool
+}
+
+func (t *kubectlTransport) Name() string {
+	return Kubectl
+}
+
+// Command accepts targets in the form of "pod" or "namespace/pod"
+func (t *kubectlTransport) Command(target string, command []string) []string {
+	kubectlCommand := []string{t.command, "exec", "-i"}
+	if t.tty {
+		kubectlCommand = append(kubectlCommand, "-t")
+	}
+	if namespace, pod, found := strings.Cut(target, "/"); found {
+		kubectlCommand = append(kubectlCommand, "-n", namespace, pod)
+	} else {
+		kubectlCommand = append(kubectlCommand, target)
+	}
+	kubectlCommand = append(kubectlCommand, "--")
+	return append(kubectlCommand, command...)
+}
+
+func (t *kubectlTransport) Start(target string, command []string, stdio Stdio) (Process, error) {
+	return startCommand(t.Command(target, command), stdio)
+}
@@ -0,0 +1,20 @@
+package transport
+
+// localTransport runs commands directly on this machine
+type localTransport struct{}
+
+func Local() Transport {
+	return &localTransport{}
+}
+
+func (t *localTransport) Name() string {
+	return "local"
+}
+
+func (t *localTransport) Command(target string, command []string) []string {
+	return command
+}
+
+func (t *localTransport) Start(target string, command []string, stdio Stdio) (Process, error) {
+	return startCommand(command, stdio)
+}
@@ -0,0 +1,59 @@
+package transport
+
+import (
+	"fmt"
+
+	"github.com/alessio/shellescape"
+	"github.com/tminaorg/ffmpegof/src/config"
+)
+
+type sshTransport struct {
+	config *config.Config
+}
+
+func (t *sshTransport) Name() string {
+	return Ssh
+}
+
+func (t *sshTransport) Command(target string, command []string) []string {
+	sshCommand := make([]string, 0)
+
+	// Add SSH component
+	sshCommand = append(sshCommand, t.config.Commands.Ssh)
+	if !t.config.Program.Debug {
+		sshCommand = append(sshCommand, "-q")
+	}
+
+	// A pseudo-terminal translates line endings and merges stderr into stdout
+	if t.config.Remote.Tty {
+		sshCommand = append(sshCommand, "-t")
+	} else {
+		sshCommand = append(sshCommand, "-T")
+	}
+
+	// Set our connection details
+	sshCommand = append(sshCommand, []string{"-o", "ConnectTimeout=1"}...)
+	sshCommand = append(sshCommand, []string{"-o", "ConnectionAttempts=1"}...)
+	sshCommand = append(sshCommand, []string{"-o", "StrictHostKeyChecking=no"}...)
+	sshCommand = append(sshCommand, []string{"-o", "UserKnownHostsFile=/dev/null"}...)
+
+	// Use SSH control persistence to keep sessions alive for subsequent commands
+	if t.config.Remote.Persist > 0 {
+		sshCommand = append(sshCommand, []string{"-o", "ControlMaster=auto"}...)
+		sshCommand = append(sshCommand, []string{"-o", fmt.Sprintf("ControlPath=%s", t.config.Directories.Persist) + "/ssh-%%r@%%h:%%p"}...)
+		sshCommand = append(sshCommand, []string{"-o", fmt.Sprintf("ControlPersist=%d", t.config.Remote.Persist)}...)
+	}
+
+	// Add the remote config args
+	sshCommand = append(sshCommand, t.config.Remote.Args...)
+
+	// Add user+host string
+	sshCommand = append(sshCommand, fmt.Sprintf("%s@%s", t.config.Remote.User, target))
+
+	// The remote shell joins the arguments, so they have to be quoted
+	return append(sshCommand, shellescape.QuoteCommand(command))
+}
+
+func (t *sshTransport) Start(target string, command []string, stdio Stdio) (Process, error) {
+	return startCommand(t.Command(target, command), stdio)
+}
@@ -0,0 +1,96 @@
+package transport
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/tminaorg/ffmpegof/src/config"
+)
+
+const (
+	Ssh     = "ssh"
+	Docker  = "docker"
+	Podman  = "podman"
+	Kubectl = "kubectl"
+	Worker  = "worker"
+)
+
+// Names of all supported transports
+var Names = []string{Ssh, Docker, Podman, Kubectl, Worker}
+
+type Stdio struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Process is a command started through a transport
+type Process interface {
+	Wait() error
+	Signal(sig os.Signal) error
+}
+
+// UsesTty reports whether commands run through the transport get a pseudo-terminal
+func UsesTty(name string, config *config.Config) bool {
+	return config.Remote.Tty && name != Worker
+}
+
+// Transport runs commands on a target host
+type Transport interface {
+	Name() string
+	Command(target string, command []string) []string
+	Start(target string, command []string, stdio Stdio) (Process, error)
+}
+
+func New(name string, config *config.Config) (Transport, error) {
+	switch name {
+	case "", Ssh:
+		return &sshTransport{config: config}, nil
+	case Docker:
+		return &containerTransport{name: Docker, command: config.Commands.Docker, tty: config.Remote.Tty}, nil
+	case Podman:
+		return &containerTransport{name: Podman, command: config.Commands.Podman, tty: config.Remote.Tty}, nil
+	case Kubectl:
+		return &kubectlTransport{command: config.Commands.Kubectl, tty: config.Remote.Tty}, nil
+	case Worker:
+		return &workerTransport{config: config}, nil
+	default:
+		return nil, fmt.Errorf("unsupported transport: %s", name)
+	}
+}
+
+// Run starts the command and waits for it to finish
+func Run(t Transport, target string, command []string, stdio Stdio) error {
+	process, err := t.Start(target, command, stdio)
+	if err != nil {
+		return err
+	}
+	return process.Wait()
+}
+
+type execProcess struct {
+	cmd *exec.Cmd
+}
+
+func (p *execProcess) Wait() error {
+	return p.cmd.Wait()
+}
+
+func (p *execProcess) Signal(sig os.Signal) error {
+	return p.cmd.Process.Signal(sig)
+}
+
+func startCommand(commandArray []string, stdio Stdio) (Process, error) {
+	commandName := commandArray[0]
+	commandArgs := commandArray[1:]
+	cmd := exec.Command(commandName, commandArgs...)
+	cmd.Stdin = stdio.Stdin
+	cmd.Stdout = stdio.Stdout
+	cmd.Stderr = stdio.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &execProcess{cmd: cmd}, nil
+}
@@ -0,0 +1,29 @@
+package transport
+
+import (
+	"github.com/tminaorg/ffmpegof/src/config"
+	"github.com/tminaorg/ffmpegof/src/worker"
+)
+
+// workerTransport runs commands through an "ffmpegof worker" agent
+type workerTransport struct {
+	config *config.Config
+}
+
+func (t *workerTransport) Name() string {
+	return Worker
+}
+
+// Command accepts targets in the form of "host" or "host:port"
+func (t *workerTransport) Command(target string, command []string) []string {
+	address := worker.NewClient(t.config, target).Address()
+	return append([]string{"worker://" + address}, command...)
+}
+
+func (t *workerTransport) Start(target string, command []string, stdio Stdio) (Process, error) {
+	process, err := worker.NewClient(t.config, target).Start(command, stdio.Stdin, stdio.Stdout, stdio.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	return process, nil
+}
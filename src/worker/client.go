@@ -0,0 +1,223 @@
+package worker
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tminaorg/ffmpegof/src/config"
+)
+
+type Client struct {
+	config  *config.Config
+	address string
+	host    string
+}
+
+// NewClient connects to targets in the form of "host" or "host:port"
+func NewClient(config *config.Config, target string) *Client {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		host = target
+		port = strconv.Itoa(config.Worker.Port)
+	}
+
+	return &Client{
+		config:  config,
+		address: net.JoinHostPort(host, port),
+		host:    host,
+	}
+}
+
+func (c *Client) Address() string {
+	return c.address
+}
+
+func (c *Client) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: time.Duration(c.config.Worker.Timeout) * time.Second}
+	if c.config.Worker.Insecure {
+		return dialer.Dial("tcp", c.address)
+	}
+
+	tlsConfig, err := clientTls(c.config, c.host)
+	if err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+	return tls.DialWithDialer(dialer, "tcp", c.address, tlsConfig)
+}
+
+func (c *Client) Info() (Info, error) {
+	info := Info{}
+
+	netConn, err := c.dial()
+	if err != nil {
+		return info, fmt.Errorf("dial: %w", err)
+	}
+	defer netConn.Close()
+
+	conn := newConn(netConn)
+	if err := conn.writeJson(frameRequest, Request{Version: protocolVersion, Type: requestInfo}); err != nil {
+		return info, err
+	}
+
+	t, payload, err := conn.readFrame()
+	if err != nil {
+		return info, fmt.Errorf("read info: %w", err)
+	}
+	switch t {
+	case frameInfo:
+		return info, json.Unmarshal(payload, &info)
+	case frameExit:
+		return info, exitError(payload)
+	default:
+		return info, fmt.Errorf("unexpected frame: %c", t)
+	}
+}
+
+// Process is a command running on a worker
+type Process struct {
+	netConn net.Conn
+	conn    *conn
+	done    chan struct{}
+	err     error
+
+	inputs  *localInputs
+	outputs []string
+}
+
+func (c *Client) Start(command []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (*Process, error) {
+	netConn, err := c.dial()
+	if err != nil {
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+
+	p := &Process{
+		netConn: netConn,
+		conn:    newConn(netConn),
+		done:    make(chan struct{}),
+		inputs:  newLocalInputs(nil),
+	}
+	request := Request{Version: protocolVersion, Type: requestExec, Command: command}
+
+	// ship inputs and outputs instead of relying on shared storage
+	if c.config.Worker.Transfer {
+		// jobs run the program behind the pre commands
+		start := 0
+		if pre := c.config.Commands.Pre; len(pre) > 0 && len(command) > len(pre) && slices.Equal(command[:len(pre)], pre) {
+			start = len(pre)
+		}
+		plan := planTransfer(command, start, command[start] == c.config.Commands.Ffprobe)
+		inputs, err := plan.transferInputs()
+		if err != nil {
+			netConn.Close()
+			return nil, err
+		}
+		request.Command = plan.command
+		request.Inputs = inputs
+		request.Outputs = len(plan.outputs)
+		p.inputs = newLocalInputs(plan.inputs)
+		p.outputs = plan.outputs
+		log.Debug().Strs("inputs", plan.inputs).Strs("outputs", plan.outputs).Msg("transferring files")
+	}
+
+	if err := p.conn.writeJson(frameRequest, request); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	go p.forwardStdin(stdin)
+	go p.receive(stdout, stderr)
+	return p, nil
+}
+
+// forwardStdin sends every read immediately, so control input like "q" isn't held back
+func (p *Process) forwardStdin(stdin io.Reader) {
+	if stdin != nil {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := stdin.Read(buf)
+			if n > 0 {
+				if errWrite := p.conn.writeFrame(frameStdin, buf[:n]); errWrite != nil {
+					return
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	// the process may be gone already, in which case there is nobody to tell
+	_ = p.conn.writeFrame(frameStdinClose, nil)
+}
+
+func (p *Process) receive(stdout io.Writer, stderr io.Writer) {
+	defer close(p.done)
+	for {
+		t, payload, err := p.conn.readFrame()
+		if err != nil {
+			p.err = fmt.Errorf("connection lost: %w", err)
+			return
+		}
+
+		switch t {
+		case frameStdout:
+			if stdout != nil {
+				_, _ = stdout.Write(payload)
+			}
+		case frameStderr:
+			if stderr != nil {
+				_, _ = stderr.Write(payload)
+			}
+		case frameReadRequest:
+			go p.readInput(payload)
+		case frameOutput:
+			if err := writeOutput(p.outputs, payload); err != nil {
+				log.Warn().Err(err).Msg("failed writing output")
+			}
+		case frameExit:
+			p.err = exitError(payload)
+			return
+		}
+	}
+}
+
+func (p *Process) Wait() error {
+	<-p.done
+	p.netConn.Close()
+	p.inputs.close()
+	return p.err
+}
+
+func (p *Process) Signal(sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return fmt.Errorf("unsupported signal: %v", sig)
+	}
+
+	select {
+	case <-p.done:
+		return os.ErrProcessDone
+	default:
+		return p.conn.writeJson(frameSignal, Signal{Signal: int(s)})
+	}
+}
+
+func exitError(payload []byte) error {
+	exit := Exit{}
+	if err := json.Unmarshal(payload, &exit); err != nil {
+		return fmt.Errorf("parse exit: %w", err)
+	}
+	if exit.Code == 0 && exit.Error == "" {
+		return nil
+	}
+	return &ExitError{Code: exit.Code, Message: exit.Error}
+}
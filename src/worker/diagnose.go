@@ -0,0 +1,169 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sys/unix"
+)
+
+// Checks a worker answers itself, so "ffmpegof test" doesn't need a shell on it. Their output is
+// the one of the shell scripts used over the other transports.
+const (
+	DiagnoseEcho       = "echo"
+	DiagnoseClock      = "clock"
+	DiagnoseDevice     = "device"
+	DiagnoseMedia      = "media"
+	DiagnoseTranscodes = "transcodes"
+)
+
+// markers written by "ffmpegof test" to find out whether the transcodes directory is shared
+const markerPrefix = ".ffmpegof-test-"
+
+// checks don't touch ffmpeg, so they answer quickly unless the storage hangs
+const diagnoseTimeout = 15 * time.Second
+
+func (s *server) diagnose(c *conn, request Request, remote string) {
+	out, err := diagnose(request.Check, request.Paths)
+	if err != nil {
+		if err := c.writeJson(frameExit, Exit{Code: 1, Error: err.Error()}); err != nil {
+			log.Warn().Err(err).Str("remote", remote).Msg("failed sending exit")
+		}
+		return
+	}
+	if err := c.writeFrame(frameStdout, []byte(out)); err != nil {
+		log.Warn().Err(err).Str("remote", remote).Msg("failed sending diagnose")
+		return
+	}
+	if err := c.writeJson(frameExit, Exit{}); err != nil {
+		log.Warn().Err(err).Str("remote", remote).Msg("failed sending exit")
+	}
+}
+
+func diagnose(check string, paths []string) (string, error) {
+	switch check {
+	case DiagnoseEcho:
+		return "ffmpegof\n", nil
+	case DiagnoseClock:
+		return strconv.FormatInt(time.Now().Unix(), 10) + "\n", nil
+	case DiagnoseDevice:
+		if len(paths) != 1 {
+			return "", fmt.Errorf("%s takes one path", check)
+		}
+		return diagnoseDevice(paths[0]), nil
+	case DiagnoseMedia:
+		out := strings.Builder{}
+		for _, path := range paths {
+			if problem := diagnoseReadable(path); problem != "" {
+				fmt.Fprintf(&out, "%s %s\n", problem, path)
+			}
+		}
+		return out.String(), nil
+	case DiagnoseTranscodes:
+		if len(paths) != 1 && len(paths) != 2 {
+			return "", fmt.Errorf("%s takes a directory and an optional marker", check)
+		}
+		return diagnoseTranscodes(paths)
+	default:
+		return "", fmt.Errorf("unknown check: %s", check)
+	}
+}
+
+func diagnoseDevice(path string) string {
+	info, err := os.Stat(path)
+	switch {
+	case err != nil:
+		return "missing\n"
+	case info.Mode()&os.ModeCharDevice == 0:
+		return "other\n"
+	case unix.Access(path, unix.R_OK|unix.W_OK) == nil:
+		return "usable\n"
+	default:
+		return "denied\n"
+	}
+}
+
+// diagnoseReadable returns why ffmpeg couldn't read the path, directories also have to be searchable
+func diagnoseReadable(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "missing"
+	}
+	mode := uint32(unix.R_OK)
+	if info.IsDir() {
+		mode |= unix.X_OK
+	}
+	if unix.Access(path, mode) != nil {
+		return "unreadable"
+	}
+	return ""
+}
+
+func diagnoseTranscodes(paths []string) (string, error) {
+	dir := paths[0]
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "missing\n", nil
+	}
+
+	file, err := os.CreateTemp(dir, markerPrefix+"*")
+	if err != nil {
+		return "readonly\n", nil
+	}
+	file.Close()
+	os.Remove(file.Name())
+	out := "writable\n"
+
+	// only markers of "ffmpegof test" may be looked for, not any path on the worker
+	if len(paths) == 2 {
+		marker := paths[1]
+		if filepath.Dir(marker) != filepath.Clean(dir) || !strings.HasPrefix(filepath.Base(marker), markerPrefix) {
+			return "", fmt.Errorf("marker %s isn't in %s", marker, dir)
+		}
+		if _, err := os.Stat(marker); err == nil {
+			out += "shared\n"
+		}
+	}
+	return out, nil
+}
+
+// Diagnose runs one of the fixed checks on the worker and returns its output
+func (c *Client) Diagnose(check string, paths ...string) (string, error) {
+	netConn, err := c.dial()
+	if err != nil {
+		return "", fmt.Errorf("dial: %w", err)
+	}
+	defer netConn.Close()
+	if err := netConn.SetDeadline(time.Now().Add(diagnoseTimeout)); err != nil {
+		return "", err
+	}
+
+	conn := newConn(netConn)
+	if err := conn.writeJson(frameRequest, Request{Version: protocolVersion, Type: requestDiagnose, Check: check, Paths: paths}); err != nil {
+		return "", err
+	}
+
+	out := strings.Builder{}
+	for {
+		t, payload, err := conn.readFrame()
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				return out.String(), fmt.Errorf("no answer within %s", diagnoseTimeout)
+			}
+			return out.String(), fmt.Errorf("read diagnose: %w", err)
+		}
+		switch t {
+		case frameStdout:
+			out.Write(payload)
+		case frameExit:
+			return out.String(), exitError(payload)
+		default:
+			return out.String(), fmt.Errorf("unexpected frame: %c", t)
+		}
+	}
+}
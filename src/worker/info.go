@@ -0,0 +1,135 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tminaorg/ffmpegof/src/config"
+)
+
+// infoCollector caches the capabilities since they don't change while the worker runs
+type infoCollector struct {
+	config  *config.Config
+	version string
+	started time.Time
+
+	once          sync.Once
+	ffmpegVersion string
+	hwaccels      []string
+	encoders      []string
+}
+
+func newInfoCollector(config *config.Config, version string) *infoCollector {
+	return &infoCollector{
+		config:  config,
+		version: version,
+		started: time.Now(),
+	}
+}
+
+func (i *infoCollector) collect(jobs int) Info {
+	i.once.Do(i.probe)
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Warn().Err(err).Msg("failed reading hostname")
+	}
+
+	return Info{
+		Version:       i.version,
+		Protocol:      protocolVersion,
+		Hostname:      hostname,
+		Os:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		FfmpegVersion: i.ffmpegVersion,
+		Hwaccels:      i.hwaccels,
+		Encoders:      i.encoders,
+		Load:          i.load(jobs),
+	}
+}
+
+func (i *infoCollector) probe() {
+	if out, err := i.ffmpeg("-version"); err != nil {
+		log.Warn().Err(err).Msg("failed reading ffmpeg version")
+	} else if line, _, _ := strings.Cut(out, "\n"); line != "" {
+		i.ffmpegVersion = strings.TrimSpace(line)
+	}
+
+	if out, err := i.ffmpeg("-hwaccels"); err != nil {
+		log.Warn().Err(err).Msg("failed reading ffmpeg hwaccels")
+	} else {
+		i.hwaccels = ParseHwaccels(out)
+	}
+
+	if out, err := i.ffmpeg("-encoders"); err != nil {
+		log.Warn().Err(err).Msg("failed reading ffmpeg encoders")
+	} else {
+		i.encoders = ParseEncoders(out)
+	}
+}
+
+func (i *infoCollector) ffmpeg(flag string) (string, error) {
+	out, err := exec.Command(i.config.Commands.Ffmpeg, "-hide_banner", flag).Output()
+	return string(out), err
+}
+
+func (i *infoCollector) load(jobs int) Load {
+	load := Load{
+		Jobs:    jobs,
+		Cpus:    runtime.NumCPU(),
+		Uptime:  time.Since(i.started).Seconds(),
+		Started: i.started.Format(time.RFC3339),
+	}
+
+	// only available on linux, other systems report zeroes
+	if data, err := os.ReadFile("/proc/loadavg"); err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) >= 3 {
+			load.Load1, _ = strconv.ParseFloat(fields[0], 64)
+			load.Load5, _ = strconv.ParseFloat(fields[1], 64)
+			load.Load15, _ = strconv.ParseFloat(fields[2], 64)
+		}
+	}
+
+	return load
+}
+
+// ParseHwaccels reads the output of "ffmpeg -hwaccels"
+func ParseHwaccels(out string) []string {
+	hwaccels := make([]string, 0)
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasSuffix(line, ":") {
+			continue
+		}
+		hwaccels = append(hwaccels, line)
+	}
+	return hwaccels
+}
+
+// ParseEncoders reads the output of "ffmpeg -encoders", the list starts after the " ------" separator
+func ParseEncoders(out string) []string {
+	encoders := make([]string, 0)
+	_, list, found := bytes.Cut([]byte(out), []byte("------"))
+	if !found {
+		return encoders
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(list))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 {
+			encoders = append(encoders, fields[1])
+		}
+	}
+	return encoders
+}
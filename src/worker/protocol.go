@@ -0,0 +1,196 @@
+package worker
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const protocolVersion = 1
+
+// maximum size of a single frame payload
+const maxFrameSize = 1 << 20
+
+type frameType byte
+
+const (
+	frameRequest    frameType = 'R'
+	frameInfo       frameType = 'I'
+	frameStdin      frameType = '0'
+	frameStdinClose frameType = 'C'
+	frameStdout     frameType = '1'
+	frameStderr     frameType = '2'
+	frameSignal     frameType = 'S'
+	frameExit       frameType = 'X'
+
+	// used when shipping inputs and outputs instead of relying on shared storage
+	frameReadRequest frameType = 'r'
+	frameReadData    frameType = 'd'
+	frameOutput      frameType = 'o'
+)
+
+const (
+	requestExec     = "exec"
+	requestInfo     = "info"
+	requestDiagnose = "diagnose"
+)
+
+type Request struct {
+	Version int      `json:"version"`
+	Type    string   `json:"type"`
+	Command []string `json:"command,omitempty"`
+
+	// Inputs are served by the client, Outputs is the number of output directories to sync back
+	Inputs  []TransferInput `json:"inputs,omitempty"`
+	Outputs int             `json:"outputs,omitempty"`
+
+	// Check is one of the fixed checks of a diagnose request, run on Paths
+	Check string   `json:"check,omitempty"`
+	Paths []string `json:"paths,omitempty"`
+}
+
+type TransferInput struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+type ReadRequest struct {
+	Id     uint64 `json:"id"`
+	Input  int    `json:"input"`
+	Offset int64  `json:"offset"`
+	Length int    `json:"length"`
+}
+
+type Output struct {
+	Dir      int    `json:"dir"`
+	Name     string `json:"name"`
+	Offset   int64  `json:"offset"`
+	Truncate bool   `json:"truncate,omitempty"`
+	Remove   bool   `json:"remove,omitempty"`
+}
+
+type Signal struct {
+	Signal int `json:"signal"`
+}
+
+type Exit struct {
+	Code  int    `json:"code"`
+	Error string `json:"error,omitempty"`
+}
+
+type Load struct {
+	Jobs    int     `json:"jobs"`
+	Cpus    int     `json:"cpus"`
+	Load1   float64 `json:"load1"`
+	Load5   float64 `json:"load5"`
+	Load15  float64 `json:"load15"`
+	Uptime  float64 `json:"uptime"`
+	Started string  `json:"started"`
+}
+
+type Info struct {
+	Version       string   `json:"version"`
+	Protocol      int      `json:"protocol"`
+	Hostname      string   `json:"hostname"`
+	Os            string   `json:"os"`
+	Arch          string   `json:"arch"`
+	FfmpegVersion string   `json:"ffmpeg_version"`
+	Hwaccels      []string `json:"hwaccels"`
+	Encoders      []string `json:"encoders"`
+	Load          Load     `json:"load"`
+}
+
+// ExitError is returned when a remote command exits with a non zero code
+type ExitError struct {
+	Code    int
+	Message string
+}
+
+func (e *ExitError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("exit status %d: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+func (e *ExitError) ExitCode() int {
+	return e.Code
+}
+
+// conn multiplexes frames over a single stream, writes are safe for concurrent use
+type conn struct {
+	rw      io.ReadWriter
+	writeMu sync.Mutex
+}
+
+func newConn(rw io.ReadWriter) *conn {
+	return &conn{rw: rw}
+}
+
+func (c *conn) writeFrame(t frameType, payload []byte) error {
+	if len(payload) > maxFrameSize {
+		return fmt.Errorf("frame too large: %d bytes", len(payload))
+	}
+
+	header := make([]byte, 5)
+	header[0] = byte(t)
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := c.rw.Write(append(header, payload...)); err != nil {
+		return fmt.Errorf("write frame: %w", err)
+	}
+	return nil
+}
+
+func (c *conn) writeJson(t frameType, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal frame: %w", err)
+	}
+	return c.writeFrame(t, payload)
+}
+
+func (c *conn) readFrame() (frameType, []byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(c.rw, header); err != nil {
+		return 0, nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxFrameSize {
+		return 0, nil, fmt.Errorf("frame too large: %d bytes", size)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.rw, payload); err != nil {
+		return 0, nil, fmt.Errorf("read frame: %w", err)
+	}
+	return frameType(header[0]), payload, nil
+}
+
+// frameWriter turns every write into a frame of the given type
+type frameWriter struct {
+	conn *conn
+	t    frameType
+}
+
+func (w *frameWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > maxFrameSize {
+			chunk = chunk[:maxFrameSize]
+		}
+		if err := w.conn.writeFrame(w.t, chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
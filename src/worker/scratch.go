@@ -0,0 +1,372 @@
+package worker
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// size of the chunks read from the client and of the output chunks sent back
+const transferChunkSize = 512 * 1024
+
+type readResult struct {
+	data []byte
+	err  error
+}
+
+type syncedFile struct {
+	info    os.FileInfo
+	sent    int64
+	running bool
+}
+
+// scratch is the private directory of a job whose files are shipped by the client,
+// inputs are served to ffmpeg over http and outputs are synced back while the job runs
+type scratch struct {
+	conn     *conn
+	dir      string
+	inputs   []TransferInput
+	outputs  int
+	listener net.Listener
+	server   *http.Server
+	// other users of the worker can reach the input server too, only ffmpeg knows the token
+	token string
+
+	mu      sync.Mutex
+	nextId  uint64
+	pending map[uint64]chan readResult
+	closed  chan struct{}
+
+	synced map[string]*syncedFile
+}
+
+func newScratch(c *conn, baseDir string, request Request) (*scratch, error) {
+	if err := validateInputs(request); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return nil, fmt.Errorf("scratch: %w", err)
+	}
+	dir, err := os.MkdirTemp(baseDir, "job-")
+	if err != nil {
+		return nil, fmt.Errorf("scratch: %w", err)
+	}
+
+	s := &scratch{
+		conn:    c,
+		dir:     dir,
+		inputs:  request.Inputs,
+		outputs: request.Outputs,
+		pending: make(map[uint64]chan readResult),
+		closed:  make(chan struct{}),
+		synced:  make(map[string]*syncedFile),
+	}
+
+	for id := 0; id < s.outputs; id++ {
+		if err := os.Mkdir(filepath.Join(dir, outputDirName(id)), 0755); err != nil {
+			s.close()
+			return nil, fmt.Errorf("scratch: %w", err)
+		}
+	}
+
+	if len(s.inputs) > 0 {
+		token := make([]byte, 16)
+		if _, err := rand.Read(token); err != nil {
+			s.close()
+			return nil, fmt.Errorf("inputs: %w", err)
+		}
+		s.token = hex.EncodeToString(token)
+
+		s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			s.close()
+			return nil, fmt.Errorf("inputs: %w", err)
+		}
+		s.server = &http.Server{Handler: http.HandlerFunc(s.serveInput)}
+		go func() {
+			if err := s.server.Serve(s.listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Warn().Err(err).Msg("failed serving inputs")
+			}
+		}()
+	}
+
+	return s, nil
+}
+
+// rewrite replaces the placeholders of a shipped command with the locations of this job
+func (s *scratch) rewrite(command []string) []string {
+	inputs := ""
+	if s.listener != nil {
+		inputs = "http://" + s.listener.Addr().String() + "/" + s.token
+	}
+
+	rewritten := make([]string, len(command))
+	for index, arg := range command {
+		arg = strings.ReplaceAll(arg, inputsPlaceholder, inputs)
+		rewritten[index] = strings.ReplaceAll(arg, scratchPlaceholder, s.dir)
+	}
+	return rewritten
+}
+
+// serveInput handles "/<token>/<id>/<name>", ranges are supported so ffmpeg can seek
+func (s *scratch) serveInput(w http.ResponseWriter, r *http.Request) {
+	token, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		http.NotFound(w, r)
+		return
+	}
+	idString, _, _ := strings.Cut(rest, "/")
+	id, err := strconv.Atoi(idString)
+	if err != nil || id < 0 || id >= len(s.inputs) {
+		http.NotFound(w, r)
+		return
+	}
+
+	input := s.inputs[id]
+	http.ServeContent(w, r, input.Name, time.Time{}, &remoteFile{scratch: s, input: input})
+}
+
+func (s *scratch) readAt(input int, offset int64, length int) ([]byte, error) {
+	s.mu.Lock()
+	id := s.nextId
+	s.nextId++
+	result := make(chan readResult, 1)
+	s.pending[id] = result
+	s.mu.Unlock()
+
+	request := ReadRequest{Id: id, Input: input, Offset: offset, Length: length}
+	if err := s.conn.writeJson(frameReadRequest, request); err != nil {
+		s.mu.Lock()
+		delete(s.pending, id)
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case r := <-result:
+		return r.data, r.err
+	case <-s.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// handleReadData passes the answer of the client to the waiting read
+func (s *scratch) handleReadData(payload []byte) {
+	id, status, data, err := decodeReadData(payload)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed parsing read data")
+		return
+	}
+
+	s.mu.Lock()
+	result, exists := s.pending[id]
+	delete(s.pending, id)
+	s.mu.Unlock()
+	if !exists {
+		return
+	}
+
+	if status != readOk {
+		result <- readResult{err: errors.New(string(data))}
+	} else {
+		result <- readResult{data: data}
+	}
+}
+
+// syncLoop syncs outputs back every interval until stop is closed
+func (s *scratch) syncLoop(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.sync(false); err != nil {
+				log.Warn().Err(err).Msg("failed syncing outputs")
+			}
+		}
+	}
+}
+
+// sync sends new data of every output file to the client. Growing files only send what was
+// appended, files that were replaced or shrank are sent again. Once the job finished, files
+// synced while it was running and changed since are sent again, since muxers like mp4 rewrite
+// their header in place.
+func (s *scratch) sync(final bool) error {
+	for dirId := 0; dirId < s.outputs; dirId++ {
+		dir := outputDirName(dirId)
+		entries, err := os.ReadDir(filepath.Join(s.dir, dir))
+		if err != nil {
+			return err
+		}
+
+		seen := make(map[string]bool)
+		for _, entry := range entries {
+			// temporary files are renamed once they are complete
+			if entry.IsDir() || strings.HasSuffix(entry.Name(), ".tmp") {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+
+			key := filepath.Join(dir, entry.Name())
+			seen[key] = true
+			previous := s.synced[key]
+
+			switch {
+			case previous == nil || !os.SameFile(previous.info, info) || info.Size() < previous.sent:
+				err = s.sendFile(dirId, key, info, 0, !final)
+			case final && previous.running && !info.ModTime().Equal(previous.info.ModTime()):
+				err = s.sendFile(dirId, key, info, 0, false)
+			case info.Size() > previous.sent:
+				err = s.sendFile(dirId, key, info, previous.sent, !final || previous.running)
+			case !info.ModTime().Equal(previous.info.ModTime()):
+				err = s.sendFile(dirId, key, info, 0, !final || previous.running)
+			}
+			// files like old hls segments may be removed while listing
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+
+		// propagate removals, e.g. of old hls segments
+		for key := range s.synced {
+			if filepath.Dir(key) != dir || seen[key] {
+				continue
+			}
+			payload, err := encodeOutput(Output{Dir: dirId, Name: filepath.Base(key), Remove: true}, nil)
+			if err != nil {
+				return err
+			}
+			if err := s.conn.writeFrame(frameOutput, payload); err != nil {
+				return err
+			}
+			delete(s.synced, key)
+		}
+	}
+
+	return nil
+}
+
+// sendFile sends the file from offset up to the size it had when it was listed
+func (s *scratch) sendFile(dirId int, key string, info os.FileInfo, offset int64, running bool) error {
+	file, err := os.Open(filepath.Join(s.dir, key))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := io.NewSectionReader(file, offset, info.Size()-offset)
+	buf := make([]byte, transferChunkSize)
+	first := true
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 || first {
+			output := Output{Dir: dirId, Name: filepath.Base(key), Offset: offset, Truncate: first && offset == 0}
+			payload, errEncode := encodeOutput(output, buf[:n])
+			if errEncode != nil {
+				return errEncode
+			}
+			if errWrite := s.conn.writeFrame(frameOutput, payload); errWrite != nil {
+				return errWrite
+			}
+			offset += int64(n)
+			first = false
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+
+	s.synced[key] = &syncedFile{info: info, sent: offset, running: running}
+	return nil
+}
+
+func (s *scratch) close() {
+	close(s.closed)
+	if s.server != nil {
+		if err := s.server.Close(); err != nil {
+			log.Warn().Err(err).Msg("failed closing input server")
+		}
+	}
+	if err := os.RemoveAll(s.dir); err != nil {
+		log.Warn().Err(err).Str("dir", s.dir).Msg("failed removing scratch dir")
+	}
+}
+
+// remoteFile reads an input from the client in chunks
+type remoteFile struct {
+	scratch *scratch
+	input   TransferInput
+	offset  int64
+
+	chunk       []byte
+	chunkOffset int64
+}
+
+func (f *remoteFile) Read(p []byte) (int, error) {
+	if f.offset >= f.input.Size {
+		return 0, io.EOF
+	}
+
+	if f.offset < f.chunkOffset || f.offset >= f.chunkOffset+int64(len(f.chunk)) {
+		data, err := f.scratch.readAt(f.input.Id, f.offset, transferChunkSize)
+		if err != nil {
+			return 0, err
+		}
+		if len(data) == 0 {
+			return 0, io.EOF
+		}
+		f.chunk = data
+		f.chunkOffset = f.offset
+	}
+
+	n := copy(p, f.chunk[f.offset-f.chunkOffset:])
+	f.offset += int64(n)
+	return n, nil
+}
+
+func (f *remoteFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.input.Size
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative offset: %d", offset)
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// validateInputs makes sure input ids can be used as indexes
+func validateInputs(request Request) error {
+	for index, input := range request.Inputs {
+		if input.Id != index {
+			return fmt.Errorf("input %d has id %d", index, input.Id)
+		}
+	}
+	return nil
+}
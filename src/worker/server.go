@@ -0,0 +1,363 @@
+package worker
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/tminaorg/ffmpegof/src/config"
+)
+
+type server struct {
+	config  *config.Config
+	version string
+
+	mu   sync.Mutex
+	jobs map[*exec.Cmd]struct{}
+	info *infoCollector
+}
+
+// Serve accepts jobs until the worker receives a termination signal
+func Serve(config *config.Config, version string) error {
+	listener, err := listen(config)
+	if err != nil {
+		return err
+	}
+	s := newServer(config, version)
+
+	// handle interrupt signal
+	quitChannel := make(chan os.Signal, 1)
+	signal.Notify(quitChannel, syscall.SIGINT, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		sig := <-quitChannel
+		log.Warn().Str("signal", sig.String()).Msg("stopping worker")
+		listener.Close()
+	}()
+
+	s.serve(listener)
+	return nil
+}
+
+func listen(config *config.Config) (net.Listener, error) {
+	var listener net.Listener
+	var err error
+	if config.Worker.Insecure {
+		// without TLS anyone who can connect may run jobs, so only this machine may
+		if !loopback(config.Worker.Listen) {
+			return nil, fmt.Errorf("worker.insecure requires worker.listen on a loopback address, got %q", config.Worker.Listen)
+		}
+		log.Warn().Msg("worker is running without TLS, only use this for local testing")
+		listener, err = net.Listen("tcp", config.Worker.Listen)
+	} else {
+		tlsConfig, errTls := serverTls(config)
+		if errTls != nil {
+			return nil, fmt.Errorf("tls: %w", errTls)
+		}
+		listener, err = tls.Listen("tcp", config.Worker.Listen, tlsConfig)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+	return listener, nil
+}
+
+func newServer(config *config.Config, version string) *server {
+	return &server{
+		config:  config,
+		version: version,
+		jobs:    make(map[*exec.Cmd]struct{}),
+		info:    newInfoCollector(config, version),
+	}
+}
+
+// serve accepts jobs until the listener is closed, then kills the ones still running
+func (s *server) serve(listener net.Listener) {
+	log.Info().Str("listen", listener.Addr().String()).Str("version", s.version).Msg("worker started")
+	for {
+		netConn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				break
+			}
+			log.Error().Err(err).Msg("failed accepting connection")
+			continue
+		}
+		go s.handle(netConn)
+	}
+
+	s.killJobs()
+}
+
+func (s *server) handle(netConn net.Conn) {
+	defer netConn.Close()
+	remote := netConn.RemoteAddr().String()
+
+	c := newConn(netConn)
+	t, payload, err := c.readFrame()
+	if err != nil {
+		log.Warn().Err(err).Str("remote", remote).Msg("failed reading request")
+		return
+	}
+	if t != frameRequest {
+		log.Warn().Str("remote", remote).Msg("first frame is not a request")
+		return
+	}
+
+	request := Request{}
+	if err := json.Unmarshal(payload, &request); err != nil {
+		log.Warn().Err(err).Str("remote", remote).Msg("failed parsing request")
+		return
+	}
+	if request.Version != protocolVersion {
+		log.Warn().Int("version", request.Version).Str("remote", remote).Msg("unsupported protocol version")
+		if err := c.writeJson(frameExit, Exit{Code: 1, Error: fmt.Sprintf("unsupported protocol version %d", request.Version)}); err != nil {
+			log.Warn().Err(err).Msg("failed sending exit")
+		}
+		return
+	}
+
+	switch request.Type {
+	case requestInfo:
+		if err := c.writeJson(frameInfo, s.info.collect(s.runningJobs())); err != nil {
+			log.Warn().Err(err).Str("remote", remote).Msg("failed sending info")
+		}
+	case requestExec:
+		s.exec(c, request, remote)
+	case requestDiagnose:
+		s.diagnose(c, request, remote)
+	default:
+		log.Warn().Str("type", request.Type).Str("remote", remote).Msg("unknown request type")
+	}
+}
+
+func (s *server) exec(c *conn, request Request, remote string) {
+	if len(request.Command) == 0 {
+		if err := c.writeJson(frameExit, Exit{Code: 1, Error: "empty command"}); err != nil {
+			log.Warn().Err(err).Msg("failed sending exit")
+		}
+		return
+	}
+	if !s.allowed(request.Command) {
+		log.Warn().Str("command", request.Command[0]).Str("remote", remote).Msg("refused command")
+		if err := c.writeJson(frameExit, Exit{Code: 126, Error: fmt.Sprintf("%s isn't commands.ffmpeg or commands.ffprobe of the worker", request.Command[0])}); err != nil {
+			log.Warn().Err(err).Msg("failed sending exit")
+		}
+		return
+	}
+
+	// jobs shipping their files get a private scratch dir
+	var jobScratch *scratch
+	command := request.Command
+	if len(request.Inputs) > 0 || request.Outputs > 0 {
+		var err error
+		jobScratch, err = newScratch(c, s.config.Worker.Scratch, request)
+		if err != nil {
+			log.Error().Err(err).Str("remote", remote).Msg("failed preparing scratch dir")
+			if err := c.writeJson(frameExit, Exit{Code: 1, Error: err.Error()}); err != nil {
+				log.Warn().Err(err).Msg("failed sending exit")
+			}
+			return
+		}
+		defer jobScratch.close()
+		command = jobScratch.rewrite(command)
+	}
+
+	log.Info().Str("remote", remote).Msg("running command")
+	log.Debug().Str("command", strings.Join(command, " ")).Msg("worker")
+
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout = &frameWriter{conn: c, t: frameStdout}
+	cmd.Stderr = &frameWriter{conn: c, t: frameStderr}
+	stdin, err := cmd.StdinPipe()
+	if err == nil {
+		err = cmd.Start()
+	}
+	if err != nil {
+		log.Error().Err(err).Str("remote", remote).Msg("failed starting command")
+		if err := c.writeJson(frameExit, Exit{Code: 127, Error: err.Error()}); err != nil {
+			log.Warn().Err(err).Msg("failed sending exit")
+		}
+		return
+	}
+	s.addJob(cmd)
+	defer s.removeJob(cmd)
+
+	// stdin is written separately so a command that doesn't read it can't block signals
+	stdinC := make(chan []byte, 64)
+	go func() {
+		defer stdin.Close()
+		for data := range stdinC {
+			if _, err := stdin.Write(data); err != nil {
+				log.Debug().Err(err).Msg("failed writing stdin")
+			}
+		}
+	}()
+
+	finished := make(chan struct{})
+	go func() {
+		stdinClosed := false
+		stdinDropped := false
+		closeStdin := func() {
+			if !stdinClosed {
+				stdinClosed = true
+				close(stdinC)
+			}
+		}
+		defer closeStdin()
+
+		for {
+			t, payload, err := c.readFrame()
+			if err != nil {
+				select {
+				case <-finished:
+				default:
+					// the client went away, so nobody is waiting for the output anymore
+					log.Warn().Err(err).Str("remote", remote).Msg("connection lost, killing command")
+					if err := cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+						log.Error().Err(err).Msg("failed killing command")
+					}
+				}
+				return
+			}
+
+			switch t {
+			case frameStdin:
+				if stdinClosed {
+					continue
+				}
+				// signals arrive on the same stream, so a command not reading stdin must not hold them up
+				select {
+				case stdinC <- payload:
+				default:
+					if !stdinDropped {
+						stdinDropped = true
+						log.Warn().Str("remote", remote).Msg("command isn't reading stdin, dropping it")
+					}
+				}
+			case frameStdinClose:
+				closeStdin()
+			case frameSignal:
+				sig := Signal{}
+				if err := json.Unmarshal(payload, &sig); err != nil {
+					log.Warn().Err(err).Msg("failed parsing signal")
+					continue
+				}
+				log.Debug().Int("signal", sig.Signal).Msg("delivering signal")
+				if err := cmd.Process.Signal(syscall.Signal(sig.Signal)); err != nil {
+					log.Warn().Err(err).Msg("failed delivering signal")
+				}
+			case frameReadData:
+				if jobScratch != nil {
+					jobScratch.handleReadData(payload)
+				}
+			}
+		}
+	}()
+
+	stopSync := make(chan struct{})
+	syncDone := make(chan struct{})
+	if jobScratch != nil {
+		go func() {
+			defer close(syncDone)
+			jobScratch.syncLoop(time.Duration(s.config.Worker.SyncInterval)*time.Millisecond, stopSync)
+		}()
+	} else {
+		close(syncDone)
+	}
+
+	exit := exitFromError(cmd.Wait())
+	close(finished)
+
+	// outputs have to be complete before the client learns about the exit
+	close(stopSync)
+	<-syncDone
+	if jobScratch != nil {
+		if err := jobScratch.sync(true); err != nil {
+			log.Error().Err(err).Str("remote", remote).Msg("failed syncing outputs")
+			if exit.Code == 0 {
+				exit = Exit{Code: 1, Error: fmt.Sprintf("failed syncing outputs: %s", err)}
+			}
+		}
+	}
+	log.Info().Int("code", exit.Code).Str("remote", remote).Msg("command finished")
+	if err := c.writeJson(frameExit, exit); err != nil {
+		log.Warn().Err(err).Msg("failed sending exit")
+	}
+}
+
+// allowed reports whether the command runs ffmpeg or ffprobe of the worker, jobs run them behind
+// its pre commands while health checks run them directly
+func (s *server) allowed(command []string) bool {
+	program := command[0]
+	if pre := s.config.Commands.Pre; len(pre) > 0 && len(command) > len(pre) && slices.Equal(command[:len(pre)], pre) {
+		program = command[len(pre)]
+	}
+	return program == s.config.Commands.Ffmpeg || program == s.config.Commands.Ffprobe
+}
+
+// loopback reports whether the listen address only accepts connections from this machine
+func loopback(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func exitFromError(err error) Exit {
+	if err == nil {
+		return Exit{}
+	}
+
+	exitErr := &exec.ExitError{}
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return Exit{Code: 128 + int(status.Signal()), Error: status.Signal().String()}
+		}
+		return Exit{Code: exitErr.ExitCode()}
+	}
+	return Exit{Code: 1, Error: err.Error()}
+}
+
+func (s *server) addJob(cmd *exec.Cmd) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[cmd] = struct{}{}
+}
+
+func (s *server) removeJob(cmd *exec.Cmd) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.jobs, cmd)
+}
+
+func (s *server) runningJobs() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.jobs)
+}
+
+func (s *server) killJobs() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for cmd := range s.jobs {
+		if err := cmd.Process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+			log.Error().Err(err).Msg("failed killing command")
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/tminaorg/ffmpegof/src/config"
+)
+
+// startServer runs an insecure worker on a free loopback port, whose "ffmpeg" is the shell so
+// tests can script the command
+func startServer(t *testing.T) *Client {
+	t.Helper()
+	conf := &config.Config{}
+	conf.Worker.Insecure = true
+	conf.Worker.Listen = "127.0.0.1:0"
+	conf.Worker.Timeout = 5
+	conf.Commands.Ffmpeg = "sh"
+	conf.Commands.Ffprobe = "ffprobe"
+
+	listener, err := listen(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(conf, "test")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.serve(listener)
+	}()
+	t.Cleanup(func() {
+		listener.Close()
+		<-done
+	})
+	return NewClient(conf, listener.Addr().String())
+}
+
+// exitCode returns the code the worker reported for the command
+func exitCode(t *testing.T, err error) int {
+	t.Helper()
+	if err == nil {
+		return 0
+	}
+	exitErr := &ExitError{}
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("not an exit: %s", err)
+	}
+	return exitErr.Code
+}
+
+func TestServerOutput(t *testing.T) {
+	client := startServer(t)
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	process, err := client.Start([]string{"sh", "-c", "read line; echo out $line; echo err >&2"}, strings.NewReader("stdin\n"), stdout, stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "out stdin\n" {
+		t.Errorf("stdout: got %q", stdout.String())
+	}
+	if stderr.String() != "err\n" {
+		t.Errorf("stderr: got %q", stderr.String())
+	}
+}
+
+func TestServerExitCode(t *testing.T) {
+	client := startServer(t)
+
+	process, err := client.Start([]string{"sh", "-c", "exit 3"}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := exitCode(t, process.Wait()); code != 3 {
+		t.Errorf("exit code: got %d, want 3", code)
+	}
+}
+
+func TestServerSignal(t *testing.T) {
+	client := startServer(t)
+
+	reader, writer := io.Pipe()
+	process, err := client.Start([]string{"sh", "-c", "echo ready; exec sleep 30"}, nil, writer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the signal has to reach the command, not the shell starting it
+	if _, err := bufio.NewReader(reader).ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+	go io.Copy(io.Discard, reader)
+
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	waited := make(chan error, 1)
+	go func() {
+		waited <- process.Wait()
+	}()
+	select {
+	case err := <-waited:
+		if code := exitCode(t, err); code != 128+int(syscall.SIGTERM) {
+			t.Errorf("exit code: got %d, want %d", code, 128+int(syscall.SIGTERM))
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("command wasn't stopped by the signal")
+	}
+}
+
+func TestServerRefusesOtherPrograms(t *testing.T) {
+	client := startServer(t)
+
+	stdout := &bytes.Buffer{}
+	process, err := client.Start([]string{"echo", "ran"}, nil, stdout, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := exitCode(t, process.Wait()); code != 126 {
+		t.Errorf("exit code: got %d, want 126", code)
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("refused command wrote %q", stdout.String())
+	}
+}
+
+func TestInsecureListen(t *testing.T) {
+	tests := []struct {
+		listen string
+		ok     bool
+	}{
+		{"127.0.0.1:0", true},
+		{"localhost:0", true},
+		{"[::1]:0", true},
+		{"0.0.0.0:0", false},
+		{":0", false},
+		{"192.0.2.1:7878", false},
+	}
+
+	for _, test := range tests {
+		conf := &config.Config{}
+		conf.Worker.Insecure = true
+		conf.Worker.Listen = test.listen
+
+		listener, err := listen(conf)
+		if listener != nil {
+			listener.Close()
+		}
+		// a loopback address may still be missing, like ::1 without ipv6
+		if !test.ok && err == nil {
+			t.Errorf("%s: insecure listen wasn't refused", test.listen)
+		}
+		if test.ok && err != nil && strings.Contains(err.Error(), "loopback") {
+			t.Errorf("%s: refused: %s", test.listen, err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/tminaorg/ffmpegof/src/config"
+)
+
+func loadCertificates(config *config.Config) (tls.Certificate, *x509.CertPool, error) {
+	cert, err := tls.LoadX509KeyPair(config.Worker.Cert, config.Worker.Key)
+	if err != nil {
+		return cert, nil, fmt.Errorf("load certificate: %w", err)
+	}
+
+	caPem, err := os.ReadFile(config.Worker.Ca)
+	if err != nil {
+		return cert, nil, fmt.Errorf("load ca: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPem) {
+		return cert, nil, fmt.Errorf("load ca: no certificates found in %s", config.Worker.Ca)
+	}
+
+	return cert, pool, nil
+}
+
+// serverTls requires clients to present a certificate signed by the configured CA
+func serverTls(config *config.Config) (*tls.Config, error) {
+	cert, pool, err := loadCertificates(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// clientTls presents our certificate and verifies the worker against the configured CA
+func clientTls(config *config.Config, serverName string) (*tls.Config, error) {
+	cert, pool, err := loadCertificates(config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Worker.ServerName != "" {
+		serverName = config.Worker.ServerName
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+		ServerName:   serverName,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
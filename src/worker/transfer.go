@@ -0,0 +1,289 @@
+package worker
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Placeholders in a shipped command, replaced by the worker once it knows where the job lives
+const (
+	inputsPlaceholder  = "{ffmpegof-inputs}"
+	scratchPlaceholder = "{ffmpegof-scratch}"
+)
+
+// options whose value is always written by ffmpeg
+var outputOptions = map[string]bool{
+	"-hls_segment_filename": true,
+	"-segment_list":         true,
+	"-vstats_file":          true,
+	"-passlogfile":          true,
+}
+
+const (
+	readOk    byte = 0
+	readError byte = 1
+)
+
+// transferPlan maps the local paths of a command onto paths inside the worker's scratch dir
+type transferPlan struct {
+	command []string
+	inputs  []string
+	outputs []string
+}
+
+func outputDirName(id int) string {
+	return fmt.Sprintf("out%d", id)
+}
+
+// localPath returns the path an argument points to, ffmpeg accepts both "/path" and "file:/path"
+func localPath(arg string) (string, string, bool) {
+	prefix := ""
+	if strings.HasPrefix(arg, "file:") {
+		prefix = "file:"
+		arg = strings.TrimPrefix(arg, "file:")
+	}
+	if !filepath.IsAbs(arg) {
+		return prefix, arg, false
+	}
+	return prefix, filepath.Clean(arg), true
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// planTransfer rewrites only the paths of the arguments after the program at index start, every
+// other argument is kept as is. Arguments of "-i" and other existing files are inputs, the last
+// argument, arguments of known output options and paths that don't exist yet inside existing
+// directories are outputs. ffprobe only reads, so all of its paths are inputs.
+func planTransfer(command []string, start int, probe bool) *transferPlan {
+	plan := &transferPlan{
+		command: make([]string, len(command)),
+		inputs:  make([]string, 0),
+		outputs: make([]string, 0),
+	}
+	inputIds := make(map[string]int)
+	outputIds := make(map[string]int)
+
+	addInput := func(path string) string {
+		id, exists := inputIds[path]
+		if !exists {
+			id = len(plan.inputs)
+			inputIds[path] = id
+			plan.inputs = append(plan.inputs, path)
+		}
+		// the input is served over http, so any "file:" prefix is dropped
+		return fmt.Sprintf("%s/%d/%s", inputsPlaceholder, id, url.PathEscape(filepath.Base(path)))
+	}
+	addOutput := func(prefix string, path string) string {
+		dir := filepath.Dir(path)
+		id, exists := outputIds[dir]
+		if !exists {
+			id = len(plan.outputs)
+			outputIds[dir] = id
+			plan.outputs = append(plan.outputs, dir)
+		}
+		return prefix + filepath.Join(scratchPlaceholder, outputDirName(id), filepath.Base(path))
+	}
+
+	copy(plan.command, command)
+	for index := start + 1; index < len(command); index++ {
+		prefix, path, ok := localPath(command[index])
+		if !ok {
+			continue
+		}
+
+		previous := command[index-1]
+		_, errStat := os.Stat(path)
+		switch {
+		case probe:
+			if isFile(path) {
+				plan.command[index] = addInput(path)
+			}
+		case previous == "-i":
+			if isFile(path) {
+				plan.command[index] = addInput(path)
+			}
+		case index == len(command)-1 || outputOptions[previous]:
+			if isDir(filepath.Dir(path)) {
+				plan.command[index] = addOutput(prefix, path)
+			}
+		case isFile(path):
+			plan.command[index] = addInput(path)
+		case os.IsNotExist(errStat) && isDir(filepath.Dir(path)):
+			plan.command[index] = addOutput(prefix, path)
+		}
+	}
+
+	return plan
+}
+
+func (plan *transferPlan) transferInputs() ([]TransferInput, error) {
+	inputs := make([]TransferInput, 0, len(plan.inputs))
+	for id, path := range plan.inputs {
+		info, err := os.Stat(path)
+		if err != nil {
+			return inputs, fmt.Errorf("stat input: %w", err)
+		}
+		inputs = append(inputs, TransferInput{Id: id, Name: filepath.Base(path), Size: info.Size()})
+	}
+	return inputs, nil
+}
+
+func encodeReadData(id uint64, status byte, data []byte) []byte {
+	payload := make([]byte, 9, 9+len(data))
+	binary.BigEndian.PutUint64(payload, id)
+	payload[8] = status
+	return append(payload, data...)
+}
+
+func decodeReadData(payload []byte) (uint64, byte, []byte, error) {
+	if len(payload) < 9 {
+		return 0, 0, nil, fmt.Errorf("read data frame too short")
+	}
+	return binary.BigEndian.Uint64(payload), payload[8], payload[9:], nil
+}
+
+func encodeOutput(output Output, data []byte) ([]byte, error) {
+	header, err := json.Marshal(output)
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]byte, 4, 4+len(header)+len(data))
+	binary.BigEndian.PutUint32(payload, uint32(len(header)))
+	payload = append(payload, header...)
+	return append(payload, data...), nil
+}
+
+func decodeOutput(payload []byte) (Output, []byte, error) {
+	output := Output{}
+	if len(payload) < 4 {
+		return output, nil, fmt.Errorf("output frame too short")
+	}
+	size := binary.BigEndian.Uint32(payload)
+	if int(size) > len(payload)-4 {
+		return output, nil, fmt.Errorf("output frame header too long")
+	}
+	if err := json.Unmarshal(payload[4:4+size], &output); err != nil {
+		return output, nil, err
+	}
+	return output, payload[4+size:], nil
+}
+
+// readInput answers a read request of the worker from a local input file
+func (p *Process) readInput(payload []byte) {
+	request := ReadRequest{}
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return
+	}
+
+	data, err := p.inputs.readAt(request)
+	status := readOk
+	if err != nil {
+		status = readError
+		data = []byte(err.Error())
+	}
+	_ = p.conn.writeFrame(frameReadData, encodeReadData(request.Id, status, data))
+}
+
+// localInputs opens the inputs of a shipped command on first use
+type localInputs struct {
+	paths []string
+
+	mu    sync.Mutex
+	files map[int]*os.File
+}
+
+func newLocalInputs(paths []string) *localInputs {
+	return &localInputs{
+		paths: paths,
+		files: make(map[int]*os.File),
+	}
+}
+
+func (l *localInputs) readAt(request ReadRequest) ([]byte, error) {
+	if request.Input < 0 || request.Input >= len(l.paths) {
+		return nil, fmt.Errorf("unknown input: %d", request.Input)
+	}
+
+	l.mu.Lock()
+	file, exists := l.files[request.Input]
+	if !exists {
+		var err error
+		file, err = os.Open(l.paths[request.Input])
+		if err != nil {
+			l.mu.Unlock()
+			return nil, err
+		}
+		l.files[request.Input] = file
+	}
+	l.mu.Unlock()
+
+	length := request.Length
+	if length > maxFrameSize-9 {
+		length = maxFrameSize - 9
+	}
+	data := make([]byte, length)
+	n, err := file.ReadAt(data, request.Offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+func (l *localInputs) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, file := range l.files {
+		file.Close()
+	}
+}
+
+// writeOutput applies a file produced by the worker to the matching local output directory
+func writeOutput(dirs []string, payload []byte) error {
+	output, data, err := decodeOutput(payload)
+	if err != nil {
+		return err
+	}
+	if output.Dir < 0 || output.Dir >= len(dirs) {
+		return fmt.Errorf("unknown output directory: %d", output.Dir)
+	}
+	if output.Name != filepath.Base(output.Name) || output.Name == "." || output.Name == ".." {
+		return fmt.Errorf("invalid output name: %s", output.Name)
+	}
+
+	path := filepath.Join(dirs[output.Dir], output.Name)
+	if output.Remove {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY
+	if output.Truncate {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.WriteAt(data, output.Offset)
+	return err
+}
@@ -0,0 +1,244 @@
+package worker
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func touch(t *testing.T, path string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlanTransfer(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "in put.mkv")
+	subtitles := filepath.Join(dir, "subs.srt")
+	program := filepath.Join(dir, "ffmpeg")
+	touch(t, input)
+	touch(t, subtitles)
+	touch(t, program)
+	out := filepath.Join(dir, "out")
+	if err := os.Mkdir(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing", "file.mkv")
+
+	in := func(id string, name string) string {
+		return inputsPlaceholder + "/" + id + "/" + name
+	}
+	scratch := func(name string) string {
+		return filepath.Join(scratchPlaceholder, "out0", name)
+	}
+
+	tests := []struct {
+		name    string
+		command []string
+		start   int
+		probe   bool
+		want    []string
+		inputs  []string
+		outputs []string
+	}{
+		{
+			name:    "input and last argument",
+			command: []string{"ffmpeg", "-i", input, "-c", "copy", filepath.Join(out, "a.mp4")},
+			want:    []string{"ffmpeg", "-i", in("0", "in%20put.mkv"), "-c", "copy", scratch("a.mp4")},
+			inputs:  []string{input},
+			outputs: []string{out},
+		},
+		{
+			name:    "file prefixes",
+			command: []string{"ffmpeg", "-i", "file:" + input, "file:" + filepath.Join(out, "a.mp4")},
+			want:    []string{"ffmpeg", "-i", in("0", "in%20put.mkv"), "file:" + scratch("a.mp4")},
+			inputs:  []string{input},
+			outputs: []string{out},
+		},
+		{
+			name:    "hls segments",
+			command: []string{"ffmpeg", "-i", input, "-hls_segment_filename", filepath.Join(out, "seg%d.ts"), filepath.Join(out, "main.m3u8")},
+			want:    []string{"ffmpeg", "-i", in("0", "in%20put.mkv"), "-hls_segment_filename", scratch("seg%d.ts"), scratch("main.m3u8")},
+			inputs:  []string{input},
+			outputs: []string{out},
+		},
+		{
+			name:    "other existing files and new files",
+			command: []string{"ffmpeg", "-i", input, "-attach", subtitles, "-passlogfile", filepath.Join(out, "log"), filepath.Join(out, "new.mkv"), "-f", "null", "-"},
+			want:    []string{"ffmpeg", "-i", in("0", "in%20put.mkv"), "-attach", in("1", "subs.srt"), "-passlogfile", scratch("log"), scratch("new.mkv"), "-f", "null", "-"},
+			inputs:  []string{input, subtitles},
+			outputs: []string{out},
+		},
+		{
+			name:    "inputs used twice",
+			command: []string{"ffmpeg", "-i", input, "-i", input, filepath.Join(out, "a.mp4")},
+			want:    []string{"ffmpeg", "-i", in("0", "in%20put.mkv"), "-i", in("0", "in%20put.mkv"), scratch("a.mp4")},
+			inputs:  []string{input},
+			outputs: []string{out},
+		},
+		{
+			name:    "ffprobe",
+			command: []string{"ffprobe", "-i", input, "-show_streams", subtitles},
+			probe:   true,
+			want:    []string{"ffprobe", "-i", in("0", "in%20put.mkv"), "-show_streams", in("1", "subs.srt")},
+			inputs:  []string{input, subtitles},
+			outputs: []string{},
+		},
+		{
+			name:    "ffprobe of a missing file",
+			command: []string{"ffprobe", filepath.Join(out, "missing.mkv")},
+			probe:   true,
+			want:    []string{"ffprobe", filepath.Join(out, "missing.mkv")},
+			inputs:  []string{},
+			outputs: []string{},
+		},
+		{
+			name:    "program behind pre commands",
+			command: []string{program, program, "-i", input, filepath.Join(out, "a.mp4")},
+			start:   1,
+			want:    []string{program, program, "-i", in("0", "in%20put.mkv"), scratch("a.mp4")},
+			inputs:  []string{input},
+			outputs: []string{out},
+		},
+		{
+			name:    "untouched",
+			command: []string{"ffmpeg", "-i", missing, "-i", "http://host/in.mkv", "-c:v", "libx264", "relative.mkv", "-y", "pipe:1"},
+			want:    []string{"ffmpeg", "-i", missing, "-i", "http://host/in.mkv", "-c:v", "libx264", "relative.mkv", "-y", "pipe:1"},
+			inputs:  []string{},
+			outputs: []string{},
+		},
+		{
+			name:    "output in a missing directory",
+			command: []string{"ffmpeg", "-i", input, missing},
+			want:    []string{"ffmpeg", "-i", in("0", "in%20put.mkv"), missing},
+			inputs:  []string{input},
+			outputs: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plan := planTransfer(test.command, test.start, test.probe)
+			if !slices.Equal(plan.command, test.want) {
+				t.Errorf("command:\n got %q\nwant %q", plan.command, test.want)
+			}
+			if !slices.Equal(plan.inputs, test.inputs) {
+				t.Errorf("inputs: got %q, want %q", plan.inputs, test.inputs)
+			}
+			if !slices.Equal(plan.outputs, test.outputs) {
+				t.Errorf("outputs: got %q, want %q", plan.outputs, test.outputs)
+			}
+		})
+	}
+}
+
+func TestWriteOutput(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "out")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	dirs := []string{dir}
+
+	write := func(output Output, data string) error {
+		payload, err := encodeOutput(output, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return writeOutput(dirs, payload)
+	}
+
+	for _, output := range []Output{
+		{Dir: 0, Name: "../x"},
+		{Dir: 0, Name: "a/b"},
+		{Dir: 0, Name: "."},
+		{Dir: 0, Name: ".."},
+		{Dir: 0, Name: ""},
+		{Dir: -1, Name: "x"},
+		{Dir: 1, Name: "x"},
+	} {
+		if err := write(output, "data"); err == nil {
+			t.Errorf("dir %d name %q: written", output.Dir, output.Name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(parent, "x")); err == nil {
+		t.Error("wrote outside of the output directory")
+	}
+
+	if err := write(Output{Dir: 0, Name: "x", Truncate: true}, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := write(Output{Dir: 0, Name: "x", Offset: 5}, " world"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "x")); string(data) != "hello world" {
+		t.Errorf("content: got %q", data)
+	}
+	if err := write(Output{Dir: 0, Name: "x", Remove: true}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "x")); !os.IsNotExist(err) {
+		t.Error("output wasn't removed")
+	}
+}
+
+func TestScratchInputToken(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	s, err := newScratch(newConn(local), t.TempDir(), Request{Inputs: []TransferInput{{Id: 0, Name: "in.mkv", Size: 4}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+
+	// answers the reads of the input server like the client does
+	go func() {
+		c := newConn(remote)
+		for {
+			_, payload, err := c.readFrame()
+			if err != nil {
+				return
+			}
+			request := ReadRequest{}
+			if err := json.Unmarshal(payload, &request); err != nil {
+				return
+			}
+			data := []byte("data")[min(request.Offset, 4):]
+			s.handleReadData(encodeReadData(request.Id, readOk, data))
+		}
+	}()
+
+	base := s.rewrite([]string{inputsPlaceholder})[0]
+	address := "http://" + s.listener.Addr().String()
+	if !strings.HasPrefix(base, address+"/") || base == address+"/" {
+		t.Fatalf("inputs aren't behind a token: %s", base)
+	}
+
+	get := func(url string) (int, string) {
+		response, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		return response.StatusCode, string(body)
+	}
+	for _, url := range []string{address + "/0/in.mkv", address + "/wrong/0/in.mkv", address + "/"} {
+		if code, _ := get(url); code != http.StatusNotFound {
+			t.Errorf("%s: got status %d, want %d", url, code, http.StatusNotFound)
+		}
+	}
+	if code, body := get(base + "/0/in.mkv"); code != http.StatusOK || body != "data" {
+		t.Errorf("with the token: got status %d and %q", code, body)
+	}
+}